@@ -0,0 +1,218 @@
+// Package main (auth_code.go) :
+// Authorization code flow with state and PKCE. The code is received by the local redirect server, and the state is verified.
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// oauthFlowFile : File for keeping the flow between showing the URL and retrieving the token by JSON control
+	oauthFlowFile = "gislack_oauth_state.json"
+	// oauthWait : Seconds for waiting for the redirect. After this, the URL is input manually.
+	oauthWait = 30
+	// oauthExpiration : Expiration of the flow saved to oauthFlowFile
+	oauthExpiration = 10 * time.Minute
+)
+
+// oauthFlow : Parameters of an authorization code flow. State and CodeVerifier are random values for each flow.
+type oauthFlow struct {
+	Provider     string    `json:"provider"`
+	State        string    `json:"state"`
+	CodeVerifier string    `json:"code_verifier,omitempty"`
+	RedirectURI  string    `json:"redirect_uri"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// newOAuthFlow : Create a flow for the provider. When pkce is true, a code verifier is created for PKCE.
+func newOAuthFlow(provider string, port int, pkce bool) *oauthFlow {
+	f := &oauthFlow{
+		Provider:    provider,
+		State:       oauthRandom(),
+		RedirectURI: "http://localhost:" + strconv.Itoa(port),
+		CreatedAt:   time.Now(),
+	}
+	if pkce {
+		f.CodeVerifier = oauthRandom()
+	}
+	return f
+}
+
+// oauthRandom : Create a random string of 32 bytes encoded by base64url.
+func oauthRandom() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// authURL : Add the state, the redirect URI and the code challenge to the authorization URL.
+func (f *oauthFlow) authURL(base string, p url.Values) string {
+	p.Set("state", f.State)
+	p.Set("redirect_uri", f.RedirectURI)
+	if len(f.CodeVerifier) > 0 {
+		sum := sha256.Sum256([]byte(f.CodeVerifier))
+		p.Set("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:]))
+		p.Set("code_challenge_method", "S256")
+	}
+	return base + p.Encode()
+}
+
+// tokenParams : Add the redirect URI and the code verifier to the parameters for retrieving the token.
+func (f *oauthFlow) tokenParams(p url.Values) url.Values {
+	p.Set("redirect_uri", f.RedirectURI)
+	if len(f.CodeVerifier) > 0 {
+		p.Set("code_verifier", f.CodeVerifier)
+	}
+	return p
+}
+
+// verify : Retrieve the code from the query of the redirect. When the state is different from the flow, an error is returned.
+func (f *oauthFlow) verify(q url.Values) (string, error) {
+	if e := q.Get("error"); len(e) > 0 {
+		return "", fmt.Errorf("%s %s", e, q.Get("error_description"))
+	}
+	if q.Get("state") != f.State {
+		return "", fmt.Errorf("State of the redirect is different from this authorization. The code was not used")
+	}
+	if len(q.Get("code")) == 0 {
+		return "", fmt.Errorf("Code was not found in the redirect")
+	}
+	return q.Get("code"), nil
+}
+
+// waitCode : Open the authorization URL with the browser, and wait for the redirect to the local server.
+// When the browser cannot be launched or the redirect doesn't come for 30 seconds, the URL after the authorization is input manually.
+func (f *oauthFlow) waitCode(authURL string) (string, error) {
+	u, _ := url.Parse(f.RedirectURI)
+	ln, err := net.Listen("tcp", u.Host)
+	if err != nil {
+		return f.inputCode(authURL)
+	}
+	type result struct {
+		code string
+		err  error
+	}
+	ch := make(chan result, 1)
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+			code, err := f.verify(r.URL.Query())
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "Error: %v", err)
+			} else {
+				fmt.Fprintf(w, "Done. Please close this page and return to %s.", appname)
+			}
+			select {
+			case ch <- result{code, err}:
+			default:
+			}
+		}),
+	}
+	go srv.Serve(ln)
+	defer srv.Shutdown(context.Background())
+	if err := oauthOpenBrowser(authURL); err != nil {
+		return f.inputCode(authURL)
+	}
+	select {
+	case r := <-ch:
+		return r.code, r.err
+	case <-time.After(oauthWait * time.Second):
+		return f.inputCode(authURL)
+	}
+}
+
+// inputCode : Input the URL of the browser after the authorization manually, and retrieve the code from it.
+func (f *oauthFlow) inputCode(authURL string) (string, error) {
+	fmt.Fprintf(os.Stderr, "Please open the following URL with your browser, and authorize it.\n%s\n\n", authURL)
+	fmt.Fprintf(os.Stderr, "After the authorization, please input the URL of the browser (it starts with %s): ", f.RedirectURI)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return "", err
+	}
+	u, err := url.Parse(strings.TrimSpace(line))
+	if err != nil {
+		return "", err
+	}
+	return f.verify(u.Query())
+}
+
+// oauthOpenBrowser : Open the URL with the default browser.
+func oauthOpenBrowser(u string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	case "darwin":
+		cmd = exec.Command("open", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+	return cmd.Start()
+}
+
+// save : Save the flow to the directory of gislack.cfg for retrieving the token by JSON control.
+func (f *oauthFlow) save(cfgdir string) {
+	b, _ := json.Marshal(f)
+	if err := ioutil.WriteFile(filepath.Join(cfgdir, oauthFlowFile), b, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// loadOAuthFlow : Load the flow saved by save, and verify the state. The file is removed after loading.
+func loadOAuthFlow(cfgdir, provider, state string) (*oauthFlow, error) {
+	path := filepath.Join(cfgdir, oauthFlowFile)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Authorization was not started. Please retrieve the URL at first")
+	}
+	os.Remove(path)
+	var f oauthFlow
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	switch {
+	case f.Provider != provider:
+		return nil, fmt.Errorf("Authorization was started for '%s'", f.Provider)
+	case time.Since(f.CreatedAt) > oauthExpiration:
+		return nil, fmt.Errorf("Authorization expired. Please retrieve the URL again")
+	case len(state) == 0 || state != f.State:
+		return nil, fmt.Errorf("State is different from the authorization. Please use 'state' returned with the code")
+	}
+	return &f, nil
+}
+
+// showAuthURL : Display the authorization URL and the state as JSON. This is for controlling by JSON.
+func (f *oauthFlow) showAuthURL(cfgdir, authURL string) {
+	f.save(cfgdir)
+	result, _ := json.Marshal(map[string]string{
+		"url":          authURL,
+		"state":        f.State,
+		"redirect_uri": f.RedirectURI,
+	})
+	fmt.Printf("%s", result)
+}
@@ -0,0 +1,206 @@
+// Package main (auth_logout.go) :
+// Revoke the access tokens of Gist and Slack, and remove them from gislack.cfg.
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tanaikech/gislack/utl"
+)
+
+// authRevokeResult : Result of revoking a token. Scrubbed means that the token was removed from gislack.cfg.
+type authRevokeResult struct {
+	Service   string `json:"service"`
+	Workspace string `json:"workspace,omitempty"`
+	Kind      string `json:"kind"`
+	Revoked   bool   `json:"revoked"`
+	Scrubbed  bool   `json:"scrubbed"`
+	Error     string `json:"error,omitempty"`
+}
+
+// authLogout : Revoke the tokens and remove them from gislack.cfg. When neither "gist" nor "slack" is used, both are revoked.
+// For Slack, only the workspace of "workspace" is revoked when it is used.
+// When the revocation failed, the token is kept in gislack.cfg for retrying. For Gist, the token is removed only when GitHub returns 204 or 404.
+func (i *iniparamsContainer) authLogout() {
+	gist, _ := i.jsonControl.Options["gist"].(bool)
+	slack, _ := i.jsonControl.Options["slack"].(bool)
+	if !gist && !slack {
+		gist, slack = true, true
+	}
+	var res []authRevokeResult
+	if gist && len(i.GislackCfg.Gist.GistAccesstoken.Accesstoken) > 0 {
+		res = append(res, i.gistRevoke())
+	}
+	if slack {
+		ws, _ := i.jsonControl.Options["workspace"].(string)
+		if len(ws) == 0 {
+			res = append(res, slackRevoke("", &i.GislackCfg.Slack.slackApp)...)
+		}
+		var names []string
+		for name := range i.GislackCfg.Slack.Workspaces {
+			if len(ws) == 0 || name == ws {
+				names = append(names, name)
+			}
+		}
+		if len(ws) > 0 && len(names) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: Workspace '%s' is not found in %s.\n", ws, cfgFile)
+			os.Exit(1)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			res = append(res, slackRevoke(name, i.GislackCfg.Slack.Workspaces[name])...)
+		}
+	}
+	if len(res) == 0 {
+		fmt.Println("No tokens to revoke.")
+		return
+	}
+	var scrubbed, failed bool
+	for _, e := range res {
+		scrubbed = scrubbed || e.Scrubbed
+		failed = failed || !e.Revoked
+	}
+	if scrubbed {
+		if err := writeCfg(i.CfgDir, i.GislackCfg, i.passphrase); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	asJSON, _ := i.jsonControl.Options["listasjson"].(bool)
+	if useJSON, _ := i.jsonControl.Options["usejsoncontrol"].(bool); asJSON || useJSON {
+		result, _ := json.MarshalIndent(res, "", "  ")
+		fmt.Println(string(result))
+	} else {
+		buffer := &bytes.Buffer{}
+		w := new(tabwriter.Writer)
+		w.Init(buffer, 0, 4, 1, ' ', 0)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", "# Service", "# Workspace", "# Token", "# Revoked", "# Removed from cfg", "# Error")
+		for _, e := range res {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%t\t%s\n", e.Service, authDash(e.Workspace), e.Kind, e.Revoked, e.Scrubbed, authDash(e.Error))
+		}
+		w.Flush()
+		fmt.Printf("%s", buffer)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// gistRevoke : Revoke the OAuth grant of GitHub using DELETE /applications/{client_id}/grant.
+// All tokens of the OAuth app for the user are revoked. A personal access token and a token of the device flow cannot be revoked without the client secret,
+// so they are only removed from gislack.cfg and have to be deleted at https://github.com/settings/tokens or https://github.com/settings/applications.
+func (i *iniparamsContainer) gistRevoke() authRevokeResult {
+	g := &i.GislackCfg.Gist
+	res := authRevokeResult{Service: "gist", Kind: "token"}
+	if len(g.ClientID) == 0 || len(g.ClientSecret) == 0 {
+		res.Error = "client ID and client secret are not found. Please delete the token at GitHub"
+		res.Scrubbed = true
+		g.GistAccesstoken = gistAccesstoken{}
+		return res
+	}
+	data, _ := json.Marshal(map[string]string{"access_token": g.GistAccesstoken.Accesstoken})
+	r := &utl.RequestParams{
+		Method:        "DELETE",
+		APIURL:        gistappurl + g.ClientID + "/grant",
+		Data:          bytes.NewReader(data),
+		AcceptHeader:  "application/vnd.github+json",
+		Contenttype:   "application/json",
+		Authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte(g.ClientID+":"+g.ClientSecret)),
+		Dtime:         10,
+	}
+	hr, err := r.FetchAPIres()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer hr.Body.Close()
+	switch hr.StatusCode {
+	case http.StatusNoContent:
+		res.Revoked = true
+	case http.StatusNotFound:
+		res.Error = "the grant was not found. The token may have already been revoked"
+	default:
+		body, _ := ioutil.ReadAll(hr.Body)
+		res.Error = fmt.Sprintf("Status Code: %d, %s", hr.StatusCode, strings.TrimSpace(string(body)))
+		// The token may still be valid, so it is kept in gislack.cfg.
+		return res
+	}
+	res.Scrubbed = true
+	g.GistAccesstoken = gistAccesstoken{}
+	return res
+}
+
+// slackRevoke : Revoke the bot token and the user token of the Slack app using auth.revoke.
+// Tokens which have already been invalid are also removed from gislack.cfg.
+func slackRevoke(workspace string, app *slackApp) []authRevokeResult {
+	at := &app.SlackAccesstoken
+	var res []authRevokeResult
+	if len(at.UserAccesstoken) > 0 && at.UserAccesstoken != at.Accesstoken {
+		r := slackRevokeToken(workspace, "user", at.UserAccesstoken)
+		if r.Scrubbed {
+			at.UserAccesstoken, at.UserScope, at.UserRefreshToken, at.UserExpiresAt = "", "", "", ""
+		}
+		res = append(res, r)
+	}
+	if len(at.Accesstoken) > 0 {
+		kind := "bot"
+		if at.TokenType != "bot" {
+			kind = "user"
+		}
+		r := slackRevokeToken(workspace, kind, at.Accesstoken)
+		if r.Scrubbed {
+			if at.UserAccesstoken == at.Accesstoken {
+				at.UserAccesstoken, at.UserScope, at.UserRefreshToken, at.UserExpiresAt = "", "", "", ""
+			}
+			at.Accesstoken, at.TokenType, at.Scope, at.BotUserID, at.CreatedAt = "", "", "", "", ""
+			at.RefreshToken, at.ExpiresAt = "", ""
+		}
+		res = append(res, r)
+	}
+	if len(at.Accesstoken) == 0 && len(at.UserAccesstoken) == 0 {
+		app.SlackAccesstoken = slackAccesstoken{}
+	}
+	return res
+}
+
+// slackRevokeToken : Revoke a token using auth.revoke.
+func slackRevokeToken(workspace, kind, token string) authRevokeResult {
+	res := authRevokeResult{Service: "slack", Workspace: workspace, Kind: kind}
+	r := &utl.RequestParams{
+		Method:      "POST",
+		APIURL:      slackurl + "auth.revoke",
+		Data:        nil,
+		Contenttype: "application/x-www-form-urlencoded",
+		Accesstoken: token,
+		Dtime:       10,
+	}
+	body, err := r.FetchAPI()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	var rv struct {
+		OK      bool   `json:"ok"`
+		Revoked bool   `json:"revoked"`
+		Error   string `json:"error"`
+	}
+	json.Unmarshal(body, &rv)
+	switch {
+	case rv.OK:
+		res.Revoked, res.Scrubbed = rv.Revoked, true
+	case rv.Error == "invalid_auth" || rv.Error == "token_revoked" || rv.Error == "account_inactive" || rv.Error == "not_authed":
+		res.Error, res.Scrubbed = rv.Error+". The token has already been invalid", true
+	default:
+		res.Error = rv.Error
+	}
+	return res
+}
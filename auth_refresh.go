@@ -0,0 +1,154 @@
+// Package main (auth_refresh.go) :
+// Refresh the tokens of Slack apps with the token rotation. The rotated tokens are saved to gislack.cfg.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/tanaikech/gislack/utl"
+)
+
+// slackRefreshMargin : Tokens expiring within this duration are refreshed.
+const slackRefreshMargin = 5 * time.Minute
+
+// slackExpiresAt : Convert expires_in to the time. When expires_in is 0, the token doesn't expire and "" is returned.
+func slackExpiresAt(expiresIn int) string {
+	if expiresIn <= 0 {
+		return ""
+	}
+	return time.Now().Add(time.Duration(expiresIn) * time.Second).Format(time.RFC3339)
+}
+
+// slackExpiring : Check whether the token expires within slackRefreshMargin.
+func slackExpiring(expiresAt string) bool {
+	t, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return false
+	}
+	return time.Until(t) < slackRefreshMargin
+}
+
+// slackExpired : Check whether the token has already expired.
+func slackExpired(expiresAt string) bool {
+	t, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return false
+	}
+	return time.Now().After(t)
+}
+
+// slackRefreshTokens : Refresh the expiring tokens of Slack before calling Slack APIs. This is run only once for each process.
+// When the token from GISLACK_SLACK_TOKEN is used, the default token is not refreshed.
+// When a token couldn't be refreshed and it has already expired, the process stops.
+func (i *iniparamsContainer) slackRefreshTokens() {
+	i.slackRefresh.Do(func() {
+		apps := map[string]*slackApp{}
+		if len(os.Getenv(slacktokenenv)) == 0 {
+			apps[""] = &i.GislackCfg.Slack.slackApp
+		}
+		for name, app := range i.GislackCfg.Slack.Workspaces {
+			apps[name] = app
+		}
+		refreshed := map[string]slackAccesstoken{}
+		for name, app := range apps {
+			ok, err := app.refresh()
+			if ok {
+				refreshed[name] = app.SlackAccesstoken
+			}
+			if err == nil {
+				continue
+			}
+			at := app.SlackAccesstoken
+			if slackExpired(at.ExpiresAt) || slackExpired(at.UserExpiresAt) {
+				fmt.Fprintf(os.Stderr, "Error: The token of Slack couldn't be refreshed. Please run '%s auth' again. [ %v ]\n", appname, err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "Warning: The token of Slack couldn't be refreshed. [ %v ]\n", err)
+		}
+		if len(refreshed) > 0 {
+			i.slackSaveTokens(refreshed)
+		}
+	})
+}
+
+// refresh : Refresh the bot token and the user token of the app when they are expiring. When a token was refreshed, true is returned.
+func (app *slackApp) refresh() (bool, error) {
+	at := &app.SlackAccesstoken
+	var refreshed bool
+	if len(at.RefreshToken) > 0 && slackExpiring(at.ExpiresAt) {
+		res, err := app.refreshToken(at.RefreshToken)
+		if err != nil {
+			return refreshed, err
+		}
+		if at.UserAccesstoken == at.Accesstoken {
+			at.UserAccesstoken, at.UserRefreshToken, at.UserExpiresAt = res.AccessToken, res.RefreshToken, slackExpiresAt(res.ExpiresIn)
+		}
+		at.Accesstoken, at.RefreshToken, at.ExpiresAt = res.AccessToken, res.RefreshToken, slackExpiresAt(res.ExpiresIn)
+		refreshed = true
+	}
+	if len(at.UserRefreshToken) > 0 && slackExpiring(at.UserExpiresAt) {
+		res, err := app.refreshToken(at.UserRefreshToken)
+		if err != nil {
+			return refreshed, err
+		}
+		at.UserAccesstoken, at.UserRefreshToken, at.UserExpiresAt = res.AccessToken, res.RefreshToken, slackExpiresAt(res.ExpiresIn)
+		refreshed = true
+	}
+	return refreshed, nil
+}
+
+// refreshToken : Retrieve a new token and a new refresh token using oauth.v2.access with grant_type=refresh_token.
+// The refresh token is rotated, so the new refresh token has to be saved.
+func (app *slackApp) refreshToken(refreshToken string) (*slackOAuthV2, error) {
+	if len(app.ClientID) == 0 || len(app.ClientSecret) == 0 {
+		return nil, fmt.Errorf("client ID and client secret of Slack are not found in %s", cfgFile)
+	}
+	p := url.Values{}
+	p.Set("grant_type", "refresh_token")
+	p.Set("refresh_token", refreshToken)
+	p.Set("client_id", app.ClientID)
+	p.Set("client_secret", app.ClientSecret)
+	r := &utl.RequestParams{
+		Method:      "POST",
+		APIURL:      slackaccesstoken + p.Encode(),
+		Data:        nil,
+		Contenttype: "application/x-www-form-urlencoded",
+		Dtime:       10,
+	}
+	body, err := r.FetchAPI()
+	if err != nil {
+		return nil, err
+	}
+	var res slackOAuthV2
+	json.Unmarshal(body, &res)
+	if !res.OK || len(res.AccessToken) == 0 {
+		return nil, fmt.Errorf("%s", res.Error)
+	}
+	return &res, nil
+}
+
+// slackSaveTokens : Save the refreshed tokens to gislack.cfg. The key of tokens is the workspace, and "" is the default.
+// gislack.cfg is read again, so the tokens of the environment variables are not saved. The file is replaced by renaming a temporary file.
+func (i *iniparamsContainer) slackSaveTokens(tokens map[string]slackAccesstoken) {
+	cfg, pass, err := readCfgWith(i.CfgDir, i.passphrase)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: The refreshed token of Slack couldn't be saved to %s. Please run '%s auth' again after this. [ %v ]\n", cfgFile, appname, err)
+		return
+	}
+	for name, t := range tokens {
+		if len(name) == 0 {
+			cfg.Slack.SlackAccesstoken = t
+			continue
+		}
+		if app, ok := cfg.Slack.Workspaces[name]; ok {
+			app.SlackAccesstoken = t
+		}
+	}
+	if err := writeCfg(i.CfgDir, cfg, pass); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: The refreshed token of Slack couldn't be saved to %s. Please run '%s auth' again after this. [ %v ]\n", cfgFile, appname, err)
+	}
+}
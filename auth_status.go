@@ -0,0 +1,320 @@
+// Package main (auth_status.go) :
+// Check the access tokens of Gist and Slack, and display the accounts, the scopes and the rate limits.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tanaikech/gislack/utl"
+)
+
+// authScopeReq : Scopes required by a command. Kind is the kind of the token of Slack used by the command.
+type authScopeReq struct {
+	Service string
+	Command string
+	Kind    string
+	Scopes  []string
+}
+
+// authScopeReqs : Scopes required by the commands of gislack
+var authScopeReqs = []authScopeReq{
+	{Service: "gist", Command: "gist, doublesubmit, submit, undo", Scopes: []string{"gist"}},
+	{Service: "slack", Command: "slack -f, doublesubmit, submit", Kind: "bot", Scopes: []string{"channels:read", "files:write"}},
+	{Service: "slack", Command: "slack -fl, -gf, -a", Kind: "bot", Scopes: []string{"files:read"}},
+	{Service: "slack", Command: "slack -chh, --format", Kind: "bot", Scopes: []string{"channels:history", "users:read"}},
+	{Service: "slack", Command: "slack -df, -dfs, doublesubmit --delete, undo", Kind: "bot", Scopes: []string{"files:write", "chat:write"}},
+	{Service: "slack", Command: "slack -dh, -dhs", Kind: "user", Scopes: []string{"channels:history", "chat:write"}},
+}
+
+// authStatus : Status of the tokens of a service. For Slack, this is created for each workspace.
+type authStatus struct {
+	Service   string              `json:"service"`
+	Workspace string              `json:"workspace,omitempty"`
+	Source    string              `json:"source,omitempty"`
+	Tokens    []authStatusToken   `json:"tokens"`
+	RateLimit *authRateLimit      `json:"rate_limit,omitempty"`
+	Commands  []authStatusCommand `json:"commands,omitempty"`
+	OK        bool                `json:"ok"`
+}
+
+// authStatusToken : Status of a token
+type authStatusToken struct {
+	Kind      string   `json:"kind"`
+	OK        bool     `json:"ok"`
+	User      string   `json:"user,omitempty"`
+	Team      string   `json:"team,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	CreatedAt string   `json:"created_at,omitempty"`
+	Age       string   `json:"age,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// authStatusCommand : Scopes which are missing for a command
+type authStatusCommand struct {
+	Command string   `json:"command"`
+	Kind    string   `json:"kind,omitempty"`
+	Missing []string `json:"missing,omitempty"`
+	Unknown bool     `json:"unknown,omitempty"`
+}
+
+// authRateLimit : Rate limit of GitHub API
+type authRateLimit struct {
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	Reset     string `json:"reset"`
+}
+
+// authStatus : Check the tokens of Gist and Slack. When a token is missing, invalid or lacks scopes, the exit code is 1.
+func (i *iniparamsContainer) authStatus() {
+	i.slackRefreshTokens()
+	var st []authStatus
+	st = append(st, i.authStatusGist())
+	st = append(st, authStatusSlack("", i.GislackCfg.Slack.SlackAccesstoken, slacktokenenv))
+	var names []string
+	for name := range i.GislackCfg.Slack.Workspaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		st = append(st, authStatusSlack(name, i.GislackCfg.Slack.Workspaces[name].SlackAccesstoken, ""))
+	}
+	ok := true
+	for _, e := range st {
+		ok = ok && e.OK
+	}
+	asJSON, _ := i.jsonControl.Options["listasjson"].(bool)
+	if useJSON, _ := i.jsonControl.Options["usejsoncontrol"].(bool); asJSON || useJSON {
+		result, _ := json.MarshalIndent(st, "", "  ")
+		fmt.Println(string(result))
+	} else {
+		authStatusDisp(st)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// authStatusGist : Check the token of Gist using GET /user and GET /rate_limit.
+func (i *iniparamsContainer) authStatusGist() authStatus {
+	at := i.GislackCfg.Gist.GistAccesstoken
+	s := authStatus{Service: "gist", Source: cfgFile}
+	if len(os.Getenv(gisttokenenv)) > 0 {
+		s.Source = gisttokenenv
+	}
+	t := authStatusToken{Kind: "token", CreatedAt: at.CreatedAt, Age: authTokenAge(at.CreatedAt)}
+	if len(at.Accesstoken) == 0 {
+		t.Error = "not found"
+		s.Tokens = append(s.Tokens, t)
+		return s
+	}
+	v, err := gistValidateToken(at.Accesstoken)
+	if err != nil {
+		t.Error = err.Error()
+		s.Tokens = append(s.Tokens, t)
+		return s
+	}
+	t.OK, t.User, t.Scopes = true, v.Login, authScopes(v.Scope)
+	s.Tokens = append(s.Tokens, t)
+	if rl, err := gistRateLimit(at.Accesstoken); err == nil {
+		s.RateLimit = rl
+	}
+	s.OK = true
+	for _, req := range authScopeReqs {
+		if req.Service == "gist" {
+			c := authScopeChk(req, t)
+			s.OK = s.OK && len(c.Missing) == 0
+			s.Commands = append(s.Commands, c)
+		}
+	}
+	return s
+}
+
+// authStatusSlack : Check the bot token and the user token of Slack using auth.test.
+// Slack doesn't return the remaining rate limit, so the rate limit is not checked.
+func authStatusSlack(workspace string, at slackAccesstoken, env string) authStatus {
+	s := authStatus{Service: "slack", Workspace: workspace, Source: cfgFile}
+	if len(env) > 0 && len(os.Getenv(env)) > 0 {
+		s.Source = env
+	}
+	tokens := map[string]authStatusToken{}
+	for _, e := range []struct{ kind, token string }{{"bot", at.Accesstoken}, {"user", at.UserAccesstoken}} {
+		if len(e.token) == 0 || (e.kind == "user" && e.token == at.Accesstoken) {
+			continue
+		}
+		kind := e.kind
+		if kind == "bot" && at.TokenType != "bot" {
+			kind = "user"
+		}
+		t := authStatusToken{Kind: kind}
+		if e.token == at.Accesstoken {
+			t.CreatedAt, t.Age = at.CreatedAt, authTokenAge(at.CreatedAt)
+		}
+		v, err := slackValidateToken(e.token)
+		if err != nil {
+			t.Error = err.Error()
+		} else {
+			t.OK, t.User, t.Team, t.Scopes = true, v.User, v.TeamName, authScopes(v.Scope)
+		}
+		tokens[kind] = t
+		s.Tokens = append(s.Tokens, t)
+	}
+	if len(s.Tokens) == 0 {
+		s.Tokens = append(s.Tokens, authStatusToken{Kind: "bot", Error: "not found"})
+		return s
+	}
+	s.OK = true
+	for _, t := range s.Tokens {
+		s.OK = s.OK && t.OK
+	}
+	for _, req := range authScopeReqs {
+		if req.Service != "slack" {
+			continue
+		}
+		t, ok := tokens[req.Kind]
+		if !ok {
+			for _, e := range tokens {
+				t = e
+			}
+		}
+		c := authScopeChk(req, t)
+		c.Kind = t.Kind
+		s.OK = s.OK && len(c.Missing) == 0
+		s.Commands = append(s.Commands, c)
+	}
+	return s
+}
+
+// authScopeChk : Check the scopes required by the command. Scopes of the legacy Slack apps like "files:write:user" are also accepted.
+// When the token has no scope information like the fine-grained tokens of GitHub, the result is unknown.
+func authScopeChk(req authScopeReq, t authStatusToken) authStatusCommand {
+	c := authStatusCommand{Command: req.Command}
+	if !t.OK {
+		c.Missing = req.Scopes
+		return c
+	}
+	if len(t.Scopes) == 0 {
+		c.Unknown = true
+		return c
+	}
+	granted := map[string]bool{}
+	for _, e := range t.Scopes {
+		granted[e] = true
+	}
+	for _, e := range req.Scopes {
+		if !granted[e] && !granted[e+":user"] && !granted[e+":bot"] {
+			c.Missing = append(c.Missing, e)
+		}
+	}
+	return c
+}
+
+// authScopes : Split scopes separated by "," or " ".
+func authScopes(v string) []string {
+	return strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// authTokenAge : Age of the token from the time it was saved. For the tokens saved by the old versions, it is empty.
+func authTokenAge(createdAt string) string {
+	t, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return ""
+	}
+	d := time.Since(t)
+	switch {
+	case d >= 24*time.Hour:
+		return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+	case d >= time.Hour:
+		return strconv.Itoa(int(d/time.Hour)) + "h"
+	default:
+		return strconv.Itoa(int(d/time.Minute)) + "m"
+	}
+}
+
+// gistRateLimit : Retrieve the rate limit of the core API of GitHub. GET /rate_limit doesn't count against the rate limit.
+func gistRateLimit(token string) (*authRateLimit, error) {
+	r := &utl.RequestParams{
+		Method:       "GET",
+		APIURL:       gistchktoken,
+		Data:         nil,
+		AcceptHeader: "application/vnd.github+json",
+		Accesstoken:  token,
+		Dtime:        10,
+	}
+	res, err := r.FetchAPIres()
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Status Code: %d", res.StatusCode)
+	}
+	rl := &authRateLimit{}
+	rl.Limit, _ = strconv.Atoi(res.Header.Get("X-RateLimit-Limit"))
+	rl.Remaining, _ = strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+	reset, _ := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
+	rl.Reset = time.Unix(reset, 0).Format("20060102_15:04:05")
+	return rl, nil
+}
+
+// authStatusDisp : Display the status as tables.
+func authStatusDisp(st []authStatus) {
+	buffer := &bytes.Buffer{}
+	w := new(tabwriter.Writer)
+	w.Init(buffer, 0, 4, 1, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", "# Service", "# Workspace", "# Token", "# Status", "# User", "# Team", "# Age", "# Rate limit", "# Source")
+	for _, s := range st {
+		rl := "-"
+		if s.RateLimit != nil {
+			rl = fmt.Sprintf("%d/%d (reset %s)", s.RateLimit.Remaining, s.RateLimit.Limit, s.RateLimit.Reset)
+		}
+		for _, t := range s.Tokens {
+			status := "ok"
+			if !t.OK {
+				status = "error: " + t.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				s.Service,
+				authDash(s.Workspace),
+				t.Kind,
+				status,
+				authDash(t.User),
+				authDash(t.Team),
+				authDash(t.Age),
+				rl,
+				s.Source,
+			)
+		}
+	}
+	fmt.Fprintf(w, "\n%s\t%s\t%s\t%s\t%s\n", "# Service", "# Workspace", "# Token", "# Command", "# Missing scopes")
+	for _, s := range st {
+		for _, c := range s.Commands {
+			missing := "-"
+			switch {
+			case c.Unknown:
+				missing = "unknown"
+			case len(c.Missing) > 0:
+				missing = strings.Join(c.Missing, ",")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Service, authDash(s.Workspace), authDash(c.Kind), c.Command, missing)
+		}
+	}
+	w.Flush()
+	fmt.Printf("%s", buffer)
+}
+
+// authDash : Return "-" for an empty value in tables.
+func authDash(v string) string {
+	if len(v) == 0 {
+		return "-"
+	}
+	return v
+}
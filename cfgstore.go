@@ -0,0 +1,240 @@
+// Package main (cfgstore.go) :
+// Read and write gislack.cfg. gislack.cfg is written with the permission 0600, and can be encrypted with a passphrase.
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+const (
+	passphraseenv = "GISLACK_PASSPHRASE"
+	// cfgScryptN, cfgScryptR, cfgScryptP : Parameters of scrypt for deriving the key from the passphrase
+	cfgScryptN = 1 << 15
+	cfgScryptR = 8
+	cfgScryptP = 1
+)
+
+// cfgCipher : Encrypted gislack.cfg. Data is gislackCfg encrypted by AES-256-GCM with the key derived by scrypt.
+type cfgCipher struct {
+	KDF   string `json:"kdf"`
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// cfgEnvelope : Envelope of gislack.cfg for checking whether the file is encrypted
+type cfgEnvelope struct {
+	Encrypted *cfgCipher `json:"encrypted,omitempty"`
+}
+
+// readCfg : Read gislack.cfg. When the file is encrypted, it is decrypted and the passphrase is also returned.
+func readCfg(cfgdir string) (gislackCfg, string, error) {
+	return readCfgWith(cfgdir, "")
+}
+
+// readCfgWith : Read gislack.cfg with the passphrase. When pass is empty and the file is encrypted, the passphrase is input.
+func readCfgWith(cfgdir, pass string) (gislackCfg, string, error) {
+	var cfg gislackCfg
+	path := filepath.Join(cfgdir, cfgFile)
+	cfgdata, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, "", err
+	}
+	cfgPermChk(path)
+	var env cfgEnvelope
+	if err := json.Unmarshal(cfgdata, &env); err != nil {
+		return cfg, "", fmt.Errorf("Format error of '%s'", cfgFile)
+	}
+	if env.Encrypted == nil {
+		if err := json.Unmarshal(cfgdata, &cfg); err != nil {
+			return cfg, "", fmt.Errorf("Format error of '%s'", cfgFile)
+		}
+		return cfg, "", nil
+	}
+	if len(pass) == 0 {
+		if pass, err = cfgPassphrase(false); err != nil {
+			return cfg, "", err
+		}
+	}
+	plain, err := env.Encrypted.decrypt(pass)
+	if err != nil {
+		return cfg, "", err
+	}
+	if err := json.Unmarshal(plain, &cfg); err != nil {
+		return cfg, "", fmt.Errorf("Format error of decrypted '%s'", cfgFile)
+	}
+	return cfg, pass, nil
+}
+
+// writeCfg : Write gislack.cfg with the permission 0600. When pass is not empty, the data is encrypted.
+// The data is written to a temporary file at first, and the file is renamed to gislack.cfg.
+func writeCfg(cfgdir string, cfg gislackCfg, pass string) error {
+	data, err := json.MarshalIndent(cfg, "", "\t")
+	if err != nil {
+		return err
+	}
+	if len(pass) > 0 {
+		c, err := encryptCfg(data, pass)
+		if err != nil {
+			return err
+		}
+		if data, err = json.MarshalIndent(cfgEnvelope{Encrypted: c}, "", "\t"); err != nil {
+			return err
+		}
+	}
+	path := filepath.Join(cfgdir, cfgFile)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0600); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// cfgKey : Derive the key for AES-256 from the passphrase.
+func (c *cfgCipher) cfgKey(pass string) ([]byte, error) {
+	if c.KDF != "scrypt" {
+		return nil, fmt.Errorf("'%s' of '%s' is not supported", c.KDF, cfgFile)
+	}
+	return scrypt.Key([]byte(pass), c.Salt, c.N, c.R, c.P, 32)
+}
+
+// encryptCfg : Encrypt data with the passphrase. A new salt and nonce are used every time.
+func encryptCfg(data []byte, pass string) (*cfgCipher, error) {
+	c := &cfgCipher{
+		KDF:  "scrypt",
+		N:    cfgScryptN,
+		R:    cfgScryptR,
+		P:    cfgScryptP,
+		Salt: make([]byte, 16),
+	}
+	if _, err := rand.Read(c.Salt); err != nil {
+		return nil, err
+	}
+	key, err := c.cfgKey(pass)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cfgGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	c.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(c.Nonce); err != nil {
+		return nil, err
+	}
+	c.Data = gcm.Seal(nil, c.Nonce, data, []byte(cfgFile))
+	return c, nil
+}
+
+// decrypt : Decrypt data with the passphrase.
+func (c *cfgCipher) decrypt(pass string) ([]byte, error) {
+	key, err := c.cfgKey(pass)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cfgGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, c.Nonce, c.Data, []byte(cfgFile))
+	if err != nil {
+		return nil, fmt.Errorf("'%s' couldn't be decrypted. The passphrase may be wrong", cfgFile)
+	}
+	return plain, nil
+}
+
+// cfgGCM : Create AES-GCM from the key.
+func cfgGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// cfgPassphrase : Retrieve the passphrase from the environment variable GISLACK_PASSPHRASE or the prompt.
+// When confirm is true, the passphrase is input twice.
+func cfgPassphrase(confirm bool) (string, error) {
+	if pass := os.Getenv(passphraseenv); len(pass) > 0 {
+		return pass, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("Passphrase for '%s' is required. Please set the environment variable %s", cfgFile, passphraseenv)
+	}
+	fmt.Fprintf(os.Stderr, "Passphrase for %s: ", cfgFile)
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(pass) == 0 {
+		return "", fmt.Errorf("Passphrase is empty")
+	}
+	if confirm {
+		fmt.Fprintf(os.Stderr, "Confirm passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if string(again) != string(pass) {
+			return "", fmt.Errorf("Passphrases are not the same")
+		}
+	}
+	return string(pass), nil
+}
+
+// cfgPermChk : Display a warning when gislack.cfg can be read by other users.
+func cfgPermChk(path string) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %s can be accessed by other users (mode %#o). Please run 'chmod 600 %s' or '%s auth migrate'.\n", path, perm, path, appname)
+	}
+}
+
+// authMigrate : Encrypt plaintext gislack.cfg with a passphrase. The passphrase is used for all commands after this.
+func (i *iniparamsContainer) authMigrate() {
+	cfg, pass, err := readCfg(i.CfgDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(pass) > 0 {
+		fmt.Printf("%s has already been encrypted.\n", cfgFile)
+		return
+	}
+	if pass, err = cfgPassphrase(true); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := writeCfg(i.CfgDir, cfg, pass); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Done.")
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/urfave/cli"
+	pb "gopkg.in/cheggaaa/pb.v1"
 )
 
 // const :
@@ -16,22 +17,33 @@ const (
 	appname    = "gislack"
 	cfgFile    = "gislack.cfg"
 	cfgpathenv = "GISLACK_CFG_PATH"
+	// gisttokenenv, slacktokenenv : Access tokens in these environment variables are used instead of gislack.cfg.
+	gisttokenenv  = "GISLACK_GIST_TOKEN"
+	slacktokenenv = "GISLACK_SLACK_TOKEN"
 
-	gisturl         = "https://api.github.com/gists"
 	gistauthcode    = "https://github.com/login/oauth/authorize?"
 	gistaccesstoken = "https://github.com/login/oauth/access_token"
-	gistchktoken    = "https://api.github.com/shibumori/whatever?"
+	gistdevicecode  = "https://github.com/login/device/code"
+	gistchktoken    = "https://api.github.com/rate_limit"
+	gistuserurl     = "https://api.github.com/user"
+	gistappurl      = "https://api.github.com/applications/"
 
-	slackurl         = "https://slack.com/api/"
-	slackauthcode    = "https://slack.com/oauth/authorize?"
-	slackaccesstoken = "https://slack.com/api/oauth.access?"
+	slackauthcode    = "https://slack.com/oauth/v2/authorize?"
+	slackaccesstoken = "https://slack.com/api/oauth.v2.access?"
 	slackchkat       = "https://slack.com/api/auth.test?"
 )
 
+// gisturl, slackurl : Endpoints of Gist and Slack. These are variables so that tests can use a fake server.
+var (
+	gisturl  = "https://api.github.com/gists"
+	slackurl = "https://slack.com/api/"
+)
+
 // initVal : Initial values
 type initVal struct {
 	pstart  time.Time
 	workdir string
+	cfgdir  string
 }
 
 // gist : Commands for gist
@@ -55,7 +67,7 @@ func gist(c *cli.Context) error {
 	}
 	if len(c.String("title")) > 0 && len(c.String("files")) > 0 &&
 		(len(c.String("updateoverwrite")) == 0 && len(c.String("updateadd")) == 0) {
-		g.defGistContainer().gistSubmit()
+		g.defGistContainer().gistSubmit().record("submit")
 		if c.Bool("simpleresult") {
 			g.simpleDisp()
 		} else {
@@ -65,7 +77,7 @@ func gist(c *cli.Context) error {
 	}
 	if (len(c.String("updateoverwrite")) > 0 || len(c.String("updateadd")) > 0) &&
 		(len(c.String("title")) > 0 || len(c.String("files")) > 0) {
-		g.gistUpdate(g.defGistContainer().gistMakeUpdate()).disp()
+		g.gistUpdate(g.defGistContainer().gistMakeUpdate()).record("update").disp()
 		return nil
 	}
 	if len(c.String("delete")) > 0 {
@@ -80,13 +92,48 @@ func gist(c *cli.Context) error {
 	return nil
 }
 
+// gitlab : Commands for snippets of GitLab
+func gitlab(c *cli.Context) error {
+	g := getAugs(c).getCfg().initGitLabContainer()
+	if c.Bool("list") || c.Bool("listasjson") {
+		g.gitlabList()
+		return nil
+	}
+	if len(c.String("get")) > 0 {
+		g.gitlabGet().disp()
+		return nil
+	}
+	if len(c.String("update")) > 0 && len(c.String("files")) > 0 {
+		g.gitlabUpdate().disp()
+		return nil
+	}
+	if len(c.String("files")) > 0 {
+		g.gitlabSubmit().disp()
+		return nil
+	}
+	if len(c.String("delete")) > 0 {
+		g.gitlabDelete()
+		return nil
+	}
+	fmt.Printf("Usage is `%s gitlab --help'\n", appname)
+	return nil
+}
+
 // slack : Commands for slack
 func slack(c *cli.Context) error {
 	s := getAugs(c).getCfg().initSlackContainer()
+	if s.slackWebhookMode() {
+		s.slackWebhookChk().slackWebhookSubmit()
+		return nil
+	}
 	if c.Bool("channellist") {
 		s.slackGetChannels().slackDispChannel()
 		return nil
 	}
+	if c.Bool("all") {
+		s.slackGetFileList().slackGetAllFiles()
+		return nil
+	}
 	if c.Bool("filelist") || c.Bool("filelistasjson") {
 		s.slackGetFileList().slackOutFilelist()
 		return nil
@@ -115,48 +162,136 @@ func slack(c *cli.Context) error {
 		s.slackGetChannelHistory().slackDeleteHistory()
 		return nil
 	}
-	if c.Int("deletehistories") > 0 {
-		s.slackGetChannelHistory().slackDeleteChannelAllHistory()
+	if c.Int("deletehistories") > 0 || c.Bool("deleteallhistories") {
+		s.slackDeleteChannelAllHistory()
 		return nil
 	}
 	fmt.Printf("Usage is `%s slack --help'\n", appname)
 	return nil
 }
 
+// mattermost : Commands for Mattermost
+func mattermost(c *cli.Context) error {
+	return chatCommand(c, "mattermost")
+}
+
+// discord : Commands for Discord
+func discord(c *cli.Context) error {
+	return chatCommand(c, "discord")
+}
+
+// chatCommand : Commands for chat services of typ. These are the same to the commands for Slack.
+func chatCommand(c *cli.Context, typ string) error {
+	s := getAugs(c).getCfg().initChatContainer(typ)
+	if c.Bool("filelist") || c.Bool("filelistasjson") {
+		s.chatGetFileList().chatDispFiles()
+		return nil
+	}
+	if len(c.String("file")) > 0 || len(c.String("content")) > 0 {
+		s.chatSubmit().disp()
+		return nil
+	}
+	if len(c.String("deletefile")) > 0 {
+		s.chatDeleteFile()
+		return nil
+	}
+	fmt.Printf("Usage is `%s %s --help'\n", appname, typ)
+	return nil
+}
+
 // doubleSubmit : Submit a file to both Gist and Slack.
 func doubleSubmit(c *cli.Context) error {
+	if len(c.String("delete")) > 0 {
+		getAugs(c).getCfg().doubleDelete()
+		return nil
+	}
+	if len(c.String("to")) > 0 && len(c.String("file")) > 0 {
+		getAugs(c).getCfg().submitToDestinations()
+		return nil
+	}
+	webhook := len(c.String("webhook-url")) > 0 || len(c.String("webhook")) > 0
 	if len(c.String("title")) > 0 &&
 		len(c.String("file")) > 0 &&
-		len(c.String("channel")) > 0 &&
+		(len(c.String("channel")) > 0 || webhook) &&
 		len(c.String("updateoverwrite")) == 0 &&
 		len(c.String("updateadd")) == 0 {
 		p := getAugs(c).getCfg()
-		res := p.doubleSubmitInit(
-			p.initGistContainer().gistSubmitReq(),
-			p.initSlackContainer().slackSubmitReq(),
-		).doubleSubmitting()
-		p.doubleSubmittingDisp(res)
+		p.doubleSubmitDo(p.initGistContainer().gistDoubleRequest(), p.initSlackContainer())
 		return nil
 	}
-	if len(c.String("channel")) > 0 &&
+	slackUpdate := c.String("slack-update") == "replace" || c.String("slack-update") == "thread"
+	if (len(c.String("channel")) > 0 || webhook || slackUpdate) &&
 		(len(c.String("title")) > 0 ||
 			len(c.String("file")) > 0) &&
 		(len(c.String("updateoverwrite")) > 0 ||
 			len(c.String("updateadd")) > 0) {
 		p := getAugs(c).getCfg()
-		res := p.doubleSubmitInit(
-			p.initGistContainer().defGistContainer().gistMakeUpdate(),
-			p.initSlackContainer().slackSubmitReq(),
-		).doubleSubmitting()
-		p.doubleSubmittingDisp(res)
+		p.doubleSubmitDo(p.initGistContainer().gistDoubleRequest(), p.initSlackContainer())
 		return nil
 	}
 	fmt.Printf("Usage is `%s doublesubmit --help'\n", appname)
 	return nil
 }
 
+// submit : Submit files to destinations of "to".
+func submit(c *cli.Context) error {
+	if len(c.String("to")) > 0 && len(c.String("file")) > 0 {
+		getAugs(c).getCfg().submitToDestinations()
+		return nil
+	}
+	fmt.Printf("Usage is `%s submit --help'\n", appname)
+	return nil
+}
+
+// history : Display the ledger of submissions.
+func history(c *cli.Context) error {
+	getAugs(c).ledgerHistory()
+	return nil
+}
+
+// undo : Delete or revert submissions of an entry of the ledger.
+func undo(c *cli.Context) error {
+	entry := c.String("entry")
+	if len(entry) == 0 {
+		entry = c.Args().First()
+	}
+	if len(entry) > 0 {
+		getAugs(c).getCfg().ledgerUndo(entry)
+		return nil
+	}
+	fmt.Printf("Usage is `%s undo --help'\n", appname)
+	return nil
+}
+
 // getaccesstopen : Rerieves access token from gist and slack.
 func getaccesstopen(c *cli.Context) error {
+	if c.Args().First() == "migrate" {
+		getAugs(c).authMigrate()
+		return nil
+	}
+	if c.Args().First() == "status" {
+		getAugs(c).getCfg().authStatus()
+		return nil
+	}
+	if c.Args().First() == "logout" {
+		getAugs(c).authInit().authLogout()
+		return nil
+	}
+	if len(c.String("gist-token")) > 0 || len(c.String("slack-token")) > 0 {
+		a := getAugs(c).authInit()
+		if len(c.String("gist-token")) > 0 {
+			a.setGistToken()
+		}
+		if len(c.String("slack-token")) > 0 {
+			a.setSlackToken()
+		}
+		a.makecfgfile()
+		return nil
+	}
+	if len(c.String("gistclientid")) > 0 && c.Bool("device") {
+		getAugs(c).authInit().getGistAccesstokenDevice().makecfgfile()
+		return nil
+	}
 	if len(c.String("gistclientid")) > 0 && len(c.String("gistclientsecret")) > 0 {
 		getAugs(c).authInit().getGistAccesstoken().makecfgfile()
 		return nil
@@ -165,6 +300,18 @@ func getaccesstopen(c *cli.Context) error {
 		getAugs(c).authInit().getSlackAccesstoken().makecfgfile()
 		return nil
 	}
+	if len(c.String("gitlabtoken")) > 0 {
+		getAugs(c).authInit().setGitLabToken().makecfgfile()
+		return nil
+	}
+	if len(c.String("mattermosttoken")) > 0 {
+		getAugs(c).authInit().setMattermostToken().makecfgfile()
+		return nil
+	}
+	if len(c.String("discordtoken")) > 0 {
+		getAugs(c).authInit().setDiscordToken().makecfgfile()
+		return nil
+	}
 	if c.Bool("chkgisttoken") {
 		getAugs(c).authInit().getGistChkToken()
 		return nil
@@ -189,10 +336,10 @@ func useJSON(c *cli.Context) error {
 			g.gistGet().disphis()
 		case (j.chkArgs("updateoverwrite").(string) == "" || j.chkArgs("updateadd").(string) == "") &&
 			(j.chkArgs("title").(string) != "" && j.chkArgs("files").(string) != ""):
-			g.defGistContainer().gistSubmit().disp()
+			g.defGistContainer().gistSubmit().record("submit").disp()
 		case (j.chkArgs("updateoverwrite").(string) != "" || j.chkArgs("updateadd").(string) != "") &&
 			(j.chkArgs("title").(string) != "" || j.chkArgs("files").(string) != ""):
-			g.gistUpdate(g.defGistContainer().gistMakeUpdate()).disp()
+			g.gistUpdate(g.defGistContainer().gistMakeUpdate()).record("update").disp()
 		case j.chkArgs("getversion").(string) != "" && j.chkArgs("gethistory").(string) == "" && j.chkArgs("get").(string) == "":
 			g.gistGet().disp()
 		case j.chkArgs("delete").(string) != "":
@@ -202,12 +349,46 @@ func useJSON(c *cli.Context) error {
 		default:
 			fmt.Println("no parameters")
 		}
+	case "gitlab":
+		j := i.getCfg().keyChk()
+		g := j.initGitLabContainer()
+		switch {
+		case j.chkArgs("list").(bool) || j.chkArgs("listasjson").(bool):
+			g.gitlabList()
+		case j.chkArgs("get").(string) != "":
+			g.gitlabGet().disp()
+		case j.chkArgs("update").(string) != "" && j.chkArgs("files").(string) != "":
+			g.gitlabUpdate().disp()
+		case j.chkArgs("files").(string) != "":
+			g.gitlabSubmit().disp()
+		case j.chkArgs("delete").(string) != "":
+			g.gitlabDelete()
+		default:
+			fmt.Println("no parameters")
+		}
+	case "mattermost", "discord":
+		j := i.getCfg().keyChk()
+		s := j.initChatContainer(i.jsonControl.Command)
+		switch {
+		case j.chkArgs("filelist").(bool) || j.chkArgs("filelistasjson").(bool):
+			s.chatGetFileList().chatDispFiles()
+		case j.chkArgs("file").(string) != "" || j.chkArgs("content").(string) != "":
+			s.chatSubmit().disp()
+		case j.chkArgs("deletefile").(string) != "":
+			s.chatDeleteFile()
+		default:
+			fmt.Println("no parameters")
+		}
 	case "slack":
 		j := i.getCfg().keyChk()
 		s := j.initSlackContainer()
 		switch {
+		case s.slackWebhookMode():
+			s.slackWebhookChk().slackWebhookSubmit()
 		case j.chkArgs("channellist").(bool):
 			s.slackGetChannels().slackDispChannel()
+		case j.chkArgs("all").(bool):
+			s.slackGetFileList().slackGetAllFiles()
 		case j.chkArgs("filelist").(bool) || j.chkArgs("filelistasjson").(bool):
 			s.slackGetFileList().slackOutFilelist()
 		case j.chkArgs("getfile").(string) != "":
@@ -223,40 +404,70 @@ func useJSON(c *cli.Context) error {
 			s.slackGetFileList().slackDeleteAllFiles()
 		case j.chkArgs("deletehistory").(string) != "":
 			s.slackGetChannelHistory().slackDeleteHistory()
-		case j.chkArgs("deletehistories").(int) > 0:
-			s.slackGetChannelHistory().slackDeleteChannelAllHistory()
+		case j.chkArgs("deletehistories").(int) > 0 || j.chkArgs("deleteallhistories").(bool):
+			s.slackDeleteChannelAllHistory()
 		}
 	case "doublesubmit":
 		j := i.getCfg().keyChk()
 		switch {
+		case j.chkArgs("delete").(string) != "":
+			j.doubleDelete()
+		case j.chkArgs("to").(string) != "" && j.chkArgs("file").(string) != "":
+			j.submitToDestinations()
 		case j.chkArgs("title").(string) != "" &&
 			j.chkArgs("file").(string) != "" &&
-			j.chkArgs("channel").(string) != "" &&
+			(j.chkArgs("channel").(string) != "" || j.useWebhook()) &&
 			j.chkArgs("updateoverwrite").(string) == "" &&
 			j.chkArgs("updateadd").(string) == "":
-			res := j.doubleSubmitInit(
-				j.initGistContainer().gistSubmitReq(),
-				j.initSlackContainer().slackSubmitReq(),
-			).doubleSubmitting()
-			j.doubleSubmittingDisp(res)
-		case j.chkArgs("channel").(string) != "" &&
+			j.doubleSubmitDo(j.initGistContainer().gistDoubleRequest(), j.initSlackContainer())
+		case (j.chkArgs("channel").(string) != "" || j.useWebhook() || j.useSlackUpdate()) &&
 			(j.chkArgs("title").(string) != "" ||
 				j.chkArgs("file").(string) != "") &&
 			(j.chkArgs("updateoverwrite").(string) != "" ||
 				j.chkArgs("updateadd").(string) != ""):
-			res := j.doubleSubmitInit(
-				j.initGistContainer().defGistContainer().gistMakeUpdate(),
-				j.initSlackContainer().slackSubmitReq(),
-			).doubleSubmitting()
-			j.doubleSubmittingDisp(res)
+			j.doubleSubmitDo(j.initGistContainer().gistDoubleRequest(), j.initSlackContainer())
+		}
+	case "submit":
+		j := i.getCfg().keyChk()
+		switch {
+		case j.chkArgs("to").(string) != "" && j.chkArgs("file").(string) != "":
+			j.submitToDestinations()
+		}
+	case "history":
+		i.keyChk().ledgerHistory()
+	case "undo":
+		j := i.getCfg().keyChk()
+		switch {
+		case j.chkArgs("entry").(string) != "":
+			j.ledgerUndo(j.chkArgs("entry").(string))
 		}
 	case "auth":
 		a := getAugs(c).keyChk().authInit()
 		switch {
+		case a.chkArgs("migrate").(bool):
+			a.authMigrate()
+		case a.chkArgs("status").(bool):
+			getAugs(c).getCfg().keyChk().authStatus()
+		case a.chkArgs("logout").(bool):
+			a.authLogout()
+		case a.chkArgs("gist-token").(string) != "" && a.chkArgs("slack-token").(string) != "":
+			a.setGistToken().setSlackToken().makecfgfile()
+		case a.chkArgs("gist-token").(string) != "":
+			a.setGistToken().makecfgfile()
+		case a.chkArgs("slack-token").(string) != "":
+			a.setSlackToken().makecfgfile()
+		case a.chkArgs("gistclientid").(string) != "" && a.chkArgs("device").(bool):
+			a.getGistAccesstokenDevice().makecfgfile()
 		case a.chkArgs("gistclientid").(string) != "" && a.chkArgs("gistclientsecret").(string) != "" && a.chkArgs("gistcode").(string) == "":
 			a.showCodeURLGist()
 		case a.chkArgs("slackclientid").(string) != "" && a.chkArgs("slackclientsecret").(string) != "" && a.chkArgs("slackcode").(string) == "":
 			a.showCodeURLSlack()
+		case a.chkArgs("gitlabtoken").(string) != "":
+			a.setGitLabToken().makecfgfile()
+		case a.chkArgs("mattermosttoken").(string) != "":
+			a.setMattermostToken().makecfgfile()
+		case a.chkArgs("discordtoken").(string) != "":
+			a.setDiscordToken().makecfgfile()
 		case a.chkArgs("gistcode").(string) != "":
 			a.getGistAccesstokenJSON().makecfgfile()
 		case a.chkArgs("slackcode").(string) != "":
@@ -324,20 +535,54 @@ func (g *gistContainer) disphis() error {
 	return nil
 }
 
-// disp : Display results for Slack
+// disp : Display results for Slack. When there are several destinations, the results are displayed as an array.
 func (s *slackContainer) disp() error {
 	if !s.jsonControl.Options["simpleresult"].(bool) {
+		var res interface{} = s.slackParams.SlackFileList
+		if len(s.slackParams.SlackResults) > 1 {
+			res = s.slackParams.SlackResults
+		}
 		var result []byte
 		if s.jsonControl.Options["jsonparser"].(bool) {
-			result, _ = json.MarshalIndent(s.slackParams.SlackFileList, "", "  ")
+			result, _ = json.MarshalIndent(res, "", "  ")
 		} else {
-			result, _ = json.Marshal(s.slackParams.SlackFileList)
+			result, _ = json.Marshal(res)
 		}
 		fmt.Println(string(result))
 	}
+	for _, e := range s.slackParams.SlackResults {
+		if !e.OK {
+			os.Exit(1)
+		}
+	}
 	return nil
 }
 
+// newProgressBar : Start a progress bar on stderr, so that results on stdout can be parsed as JSON.
+func newProgressBar(total int) *pb.ProgressBar {
+	bar := pb.New(total)
+	bar.Output = os.Stderr
+	return bar.Start()
+}
+
+// dispBulkResult : Display the completed items of a bulk process. When the process was interrupted by SIGINT, the exit code is 130.
+// canceled is the item whose request was canceled by SIGINT. It is unknown whether it was processed.
+func dispBulkResult(kind string, done []string, total int, interrupted bool, canceled string) {
+	if interrupted {
+		fmt.Fprintf(os.Stderr, "Interrupted. ")
+	}
+	fmt.Fprintf(os.Stderr, "%d of %d %s were deleted.\n", len(done), total, kind)
+	for _, e := range done {
+		fmt.Fprintf(os.Stderr, "  %s\n", e)
+	}
+	if len(canceled) > 0 {
+		fmt.Fprintf(os.Stderr, "The request for %s was canceled, so it is unknown whether it was deleted.\n", canceled)
+	}
+	if interrupted {
+		os.Exit(130)
+	}
+}
+
 // commandNotFound :
 func commandNotFound(c *cli.Context, command string) {
 	fmt.Fprintf(os.Stderr, "'%s' is not a %s command. Check '%s --help' or '%s -h'.", command, c.App.Name, c.App.Name, c.App.Name)
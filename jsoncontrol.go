@@ -5,18 +5,18 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"time"
 
+	"github.com/tanaikech/gislack/utl"
 	"github.com/urfave/cli"
 )
 
 // jsonControl : Struct for controlling JSON
 type jsonControl struct {
-	Command string                 `json:"command"` // gist, slack, doublesubmit, auth
+	Command string                 `json:"command"` // gist, gitlab, slack, mattermost, discord, doublesubmit, submit, auth
 	Options map[string]interface{} `json:"options"`
 }
 
@@ -42,6 +42,16 @@ func getAugs(c *cli.Context) *iniparamsContainer {
 				obj[e] = c.Bool(e)
 			}
 		}
+		for _, e := range []string{"connect-timeout", "header-timeout", "timeout"} {
+			if v := c.Int(e); v > 0 {
+				obj[e] = v
+			}
+		}
+		for _, e := range []string{"proxy", "no-proxy", "cacert", "cert", "key"} {
+			if v := c.String(e); len(v) > 0 {
+				obj[e] = v
+			}
+		}
 		j.Options = obj
 	}
 	i := &iniparamsContainer{
@@ -69,25 +79,79 @@ func getAugs(c *cli.Context) *iniparamsContainer {
 
 // getCfg : Get data from a CFG file
 func (i *iniparamsContainer) getCfg() *iniparamsContainer {
-	p := &authParams{}
+	p := &authParams{
+		WorkDir: i.WorkDir,
+		CfgDir:  i.CfgDir,
+	}
 	p.pstart = time.Now()
-	if cfgdata, err := ioutil.ReadFile(filepath.Join(i.CfgDir, cfgFile)); err == nil {
-		err = json.Unmarshal(cfgdata, &p.GislackCfg)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Format error of '%s'. ", cfgFile)
-			os.Exit(1)
-		}
-	} else {
-		if i.jsonControl.Command != "auth" {
+	cfg, pass, err := readCfg(i.CfgDir)
+	switch {
+	case err == nil:
+		p.GislackCfg, p.passphrase = cfg, pass
+	case !os.IsNotExist(err):
+		fmt.Fprintf(os.Stderr, "Error: %v. ", err)
+		os.Exit(1)
+	default:
+		webhookURL, _ := i.jsonControl.Options["webhook-url"].(string)
+		if len(os.Getenv(gisttokenenv)) == 0 && len(os.Getenv(slacktokenenv)) == 0 && len(webhookURL) == 0 && i.jsonControl.Command != "auth" {
 			fmt.Printf("Error: %s.cfg is not found. Please authorization for gist and/or slack you want to use. Please access token by executing '%s auth'.\n", appname, appname)
 			os.Exit(1)
 		}
 	}
+	p.envTokens()
 	i.authParams = p
 	i.jsonControl.Options["usejsoncontrol"] = false
+	i.setNetwork()
 	return i
 }
 
+// setNetwork : Set the timeouts, the proxy and TLS for all requests including the authorization and downloading files.
+func (i *iniparamsContainer) setNetwork() {
+	i.setTimeouts()
+	t := utl.Transport{}
+	if c := i.GislackCfg.Network; c != nil {
+		t = utl.Transport{Proxy: c.Proxy, NoProxy: c.NoProxy, CAFile: c.CAFile, CertFile: c.CertFile, KeyFile: c.KeyFile}
+	}
+	for key, v := range map[string]*string{"proxy": &t.Proxy, "no-proxy": &t.NoProxy, "cacert": &t.CAFile, "cert": &t.CertFile, "key": &t.KeyFile} {
+		if s, _ := i.jsonControl.Options[key].(string); len(s) > 0 {
+			*v = s
+		}
+	}
+	if err := utl.SetTransport(t); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v.\n", err)
+		os.Exit(1)
+	}
+}
+
+// setTimeouts : Set the timeouts of requests. The options of timeouts are used instead of "timeouts" of gislack.cfg.
+func (i *iniparamsContainer) setTimeouts() {
+	var sec [3]int
+	if c := i.GislackCfg.Timeouts; c != nil {
+		sec = [3]int{c.Connect, c.ResponseHeader, c.Overall}
+	}
+	for n, key := range []string{"connect-timeout", "header-timeout", "timeout"} {
+		switch v := i.jsonControl.Options[key].(type) {
+		case int:
+			if v > 0 {
+				sec[n] = v
+			}
+		case float64:
+			if v > 0 {
+				sec[n] = int(v)
+			}
+		}
+	}
+	t := utl.Timeouts{
+		Connect:        time.Duration(sec[0]) * time.Second,
+		ResponseHeader: time.Duration(sec[1]) * time.Second,
+		Overall:        time.Duration(sec[2]) * time.Second,
+	}
+	if t.Connect == 0 {
+		t.Connect = 10 * time.Second
+	}
+	utl.SetTimeouts(t)
+}
+
 // keyChk : Check keys for controlling JSON
 func (i *iniparamsContainer) keyChk() *iniparamsContainer {
 	boolkeys := []string{
@@ -105,6 +169,20 @@ func (i *iniparamsContainer) keyChk() *iniparamsContainer {
 		"chkgisttoken",
 		"filelistasjson",
 		"appcheck",
+		"stdout",
+		"all",
+		"deleteallhistories",
+		"dryrun",
+		"blocks",
+		"link",
+		"atomic",
+		"migrate",
+		"device",
+		"as-user",
+		"status",
+		"logout",
+		"gist",
+		"slack",
 	}
 	for _, key := range boolkeys {
 		if i.chkArgs(key) == nil {
@@ -138,6 +216,42 @@ func (i *iniparamsContainer) keyChk() *iniparamsContainer {
 		"workdir",
 		"getversion",
 		"gethistory",
+		"out",
+		"since",
+		"until",
+		"contains",
+		"format",
+		"workspace",
+		"webhook-url",
+		"webhook",
+		"template",
+		"slackmode",
+		"filename",
+		"to",
+		"update",
+		"project",
+		"visibility",
+		"description",
+		"gitlabtoken",
+		"gitlaburl",
+		"team",
+		"mattermosttoken",
+		"mattermosturl",
+		"mattermostteam",
+		"discordtoken",
+		"query",
+		"entry",
+		"slack-update",
+		"gist-token",
+		"slack-token",
+		"state",
+		"slack-bot-scopes",
+		"slack-user-scopes",
+		"proxy",
+		"no-proxy",
+		"cacert",
+		"cert",
+		"key",
 	}
 	for _, key := range stringkeys {
 		if i.chkArgs(key) == nil {
@@ -149,6 +263,18 @@ func (i *iniparamsContainer) keyChk() *iniparamsContainer {
 	} else {
 		i.jsonControl.Options["deletehistories"] = int(i.jsonControl.Options["deletehistories"].(float64))
 	}
+	if i.chkArgs("limit") == nil {
+		i.jsonControl.Options["limit"] = 0
+	} else {
+		i.jsonControl.Options["limit"] = int(i.jsonControl.Options["limit"].(float64))
+	}
+	for _, key := range []string{"connect-timeout", "header-timeout", "timeout"} {
+		if i.chkArgs(key) == nil {
+			i.jsonControl.Options[key] = 0
+		} else if v, ok := i.jsonControl.Options[key].(float64); ok {
+			i.jsonControl.Options[key] = int(v)
+		}
+	}
 	if i.chkArgs("port") == nil {
 		i.jsonControl.Options["port"] = 8080
 	} else {
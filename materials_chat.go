@@ -0,0 +1,196 @@
+// Package main (materials_chat.go) :
+// Materials for chat services except for Slack. Mattermost and Discord are used like Slack.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// chatDest : A chat service as a destination. Files posted to the channel can be listed.
+type chatDest interface {
+	Destination
+	Files() ([]chatFile, error)
+}
+
+// chatFile : A file posted to a channel
+type chatFile struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	MessageID   string    `json:"message_id"`
+	User        string    `json:"user,omitempty"`
+	Size        int64     `json:"size,omitempty"`
+	URL         string    `json:"url,omitempty"`
+	CreatedTime time.Time `json:"createdtime"`
+}
+
+// chatContainer : Container included parameters
+type chatContainer struct {
+	*initVal
+	Type   string
+	Cfg    destinationCfg
+	Dest   chatDest
+	Result destResult
+	Files  []chatFile
+	*jsonControl
+}
+
+// initChatContainer : Initialize parameters for a chat service of typ. "channel", "team", "webhook-url" and "webhook" are used.
+func (i *iniparamsContainer) initChatContainer(typ string) *chatContainer {
+	c := &chatContainer{
+		&initVal{
+			pstart:  i.authParams.pstart,
+			workdir: i.authParams.WorkDir,
+			cfgdir:  i.authParams.CfgDir,
+		},
+		typ,
+		destinationCfg{},
+		nil,
+		destResult{},
+		nil,
+		i.jsonControl,
+	}
+	for _, key := range []string{"title", "filename", "team", "webhook-url", "webhook"} {
+		if _, ok := c.jsonControl.Options[key].(string); !ok {
+			c.jsonControl.Options[key] = ""
+		}
+	}
+	if _, ok := c.jsonControl.Options["public"].(bool); !ok {
+		c.jsonControl.Options["public"] = false
+	}
+	cfg := destinationCfg{
+		Type:    typ,
+		Channel: c.jsonControl.Options["channel"].(string),
+		Team:    c.jsonControl.Options["team"].(string),
+		Webhook: c.jsonControl.Options["webhook-url"].(string),
+	}
+	if len(cfg.Webhook) == 0 {
+		cfg.Webhook = c.jsonControl.Options["webhook"].(string)
+	}
+	c.Cfg = cfg
+	d, err := destinationTypes[typ](i, typ, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v.\n", err)
+		os.Exit(1)
+	}
+	c.Dest = d.(chatDest)
+	return c
+}
+
+// chatSubmit : Post files or content with the initial comment to the channel.
+func (c *chatContainer) chatSubmit() *chatContainer {
+	p := c.jsonControl.destPayload(c.workdir)
+	if content := c.jsonControl.Options["content"].(string); len(p.Files) == 0 && len(content) > 0 {
+		p.Comment = strings.TrimSpace(p.Comment + "\n" + content)
+	}
+	c.Result = c.Dest.Submit(p)
+	return c.record()
+}
+
+// chatGetFileList : Retrieve files posted to the channel.
+func (c *chatContainer) chatGetFileList() *chatContainer {
+	files, err := c.Dest.Files()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	c.Files = files
+	return c
+}
+
+// chatDispFiles : Display file list as a table or JSON.
+func (c *chatContainer) chatDispFiles() {
+	if len(c.Files) == 0 {
+		fmt.Println("No files.")
+		return
+	}
+	if c.jsonControl.Options["filelistasjson"].(bool) {
+		result, _ := json.Marshal(c.Files)
+		fmt.Println(string(result))
+		return
+	}
+	buffer := &bytes.Buffer{}
+	w := new(tabwriter.Writer)
+	w.Init(buffer, 0, 4, 1, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", "# Name", "# Created time", "# fileID", "# messageID", "# user")
+	for _, e := range c.Files {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			e.Name,
+			e.CreatedTime.Format("20060102_15:04:05"),
+			e.ID,
+			e.MessageID,
+			e.User,
+		)
+	}
+	w.Flush()
+	fmt.Printf("%s", buffer)
+	fmt.Printf("\n Total : %d", len(c.Files))
+}
+
+// chatDeleteFile : Delete a message with the files. Files of chat services are deleted with the message.
+func (c *chatContainer) chatDeleteFile() {
+	r := c.Dest.Delete(c.jsonControl.Options["deletefile"].(string))
+	if !r.OK {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", r.Error)
+		os.Exit(1)
+	}
+	fmt.Println("Done.")
+}
+
+// disp : Display results for a chat service
+func (c *chatContainer) disp() {
+	if c.jsonControl.Options["simpleresult"].(bool) {
+		result, _ := json.Marshal(map[string]interface{}{c.Type + "_id": c.Result.ID, "ok": c.Result.OK})
+		fmt.Println(string(result))
+	} else {
+		var result []byte
+		if c.jsonControl.Options["jsonparser"].(bool) {
+			result, _ = json.MarshalIndent(c.Result, "", "  ")
+		} else {
+			result, _ = json.Marshal(c.Result)
+		}
+		fmt.Println(string(result))
+	}
+	if !c.Result.OK {
+		os.Exit(1)
+	}
+}
+
+// chatMessage : Create a message from the title and the comment.
+func chatMessage(p *destPayload) string {
+	if len(p.Title) == 0 {
+		return p.Comment
+	}
+	return strings.TrimSpace("**" + p.Title + "**\n" + p.Comment)
+}
+
+// chatMultipart : Create a body of multipart/form-data with fields and files. The field name of each file is given by fileField.
+func chatMultipart(fields map[string]string, files []destFile, fileField func(n int) string) (*bytes.Buffer, string, error) {
+	b := &bytes.Buffer{}
+	w := multipart.NewWriter(b)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			return nil, "", err
+		}
+	}
+	for n, f := range files {
+		part, err := w.CreateFormFile(fileField(n), f.Name)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := io.Copy(part, bytes.NewReader(f.Data)); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return b, w.FormDataContentType(), nil
+}
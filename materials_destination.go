@@ -0,0 +1,301 @@
+// Package main (materials_destination.go) :
+// Materials for destinations. Files are submitted to several services through Destination.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tanaikech/gislack/utl"
+)
+
+// Destination : A service which files are submitted to. Gist, GitLab, Slack, Mattermost and Discord are destinations.
+type Destination interface {
+	Name() string
+	Submit(p *destPayload) destResult
+	Update(id string, p *destPayload) destResult
+	Delete(id string) destResult
+	Get(id string) destResult
+}
+
+// destinationCfg : A destination in "destinations" of gislack.cfg
+type destinationCfg struct {
+	Type       string `json:"type"`
+	Public     bool   `json:"public,omitempty"`
+	Workspace  string `json:"workspace,omitempty"`
+	Channel    string `json:"channel,omitempty"`
+	Token      string `json:"token,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Project    string `json:"project,omitempty"`
+	Visibility string `json:"visibility,omitempty"`
+	Team       string `json:"team,omitempty"`
+	Webhook    string `json:"webhook,omitempty"`
+}
+
+// destFile : A file for destinations
+type destFile struct {
+	Name string
+	Data []byte
+}
+
+// destPayload : Payload for destinations. Content is submitted as a text when there are no files, and Filetype is used by Slack.
+// Remove is the names of files removed from the gist by Update.
+type destPayload struct {
+	Title    string
+	Comment  string
+	Public   bool
+	Files    []destFile
+	Content  string
+	Filetype string
+	Remove   []string
+}
+
+// destResult : Result from a destination. When several files are submitted to a destination which has an ID for each file, ID is the IDs separated by ",".
+type destResult struct {
+	Destination string          `json:"destination"`
+	Type        string          `json:"type"`
+	Action      string          `json:"action"`
+	ID          string          `json:"id,omitempty"`
+	URL         string          `json:"url,omitempty"`
+	OK          bool            `json:"ok"`
+	StatusCode  int             `json:"status_code,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Et          float64         `json:"ElapsedTime"`
+	Response    json.RawMessage `json:"response,omitempty"`
+}
+
+// destResults : Results from all destinations
+type destResults struct {
+	Results []destResult `json:"results"`
+	TotalEt float64      `json:"TotalElapsedTime,omitempty"`
+}
+
+// destinationTypes : Constructors of destinations for each type.
+var destinationTypes = map[string]func(i *iniparamsContainer, name string, c destinationCfg) (Destination, error){
+	"gist":       newGistDest,
+	"slack":      newSlackDest,
+	"gitlab":     newGitLabDest,
+	"mattermost": newMattermostDest,
+	"discord":    newDiscordDest,
+}
+
+// destinations : Resolve names separated by "," to destinations.
+// A name is a destination in gislack.cfg or a type of destination like "gist" and "slack".
+// All destinations are validated before any submission.
+func (i *iniparamsContainer) destinations(names string) []Destination {
+	var ds []Destination
+	var errs []string
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); len(name) == 0 {
+			continue
+		}
+		c := i.destinationCfgOf(name)
+		newDest, ok := destinationTypes[c.Type]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("Destination '%s' is not found in 'destinations' of %s, and type '%s' is not supported.", name, cfgFile, c.Type))
+			continue
+		}
+		d, err := newDest(i, name, c)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		ds = append(ds, d)
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: Nothing was submitted.\n  %s\n", strings.Join(errs, "\n  "))
+		os.Exit(1)
+	}
+	if len(ds) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: Please input destinations using '--to' like 'gist,slack'.\n")
+		os.Exit(1)
+	}
+	return ds
+}
+
+// destinationCfgOf : Retrieve the destination of name from gislack.cfg. When name is not found, name is used as the type.
+func (i *iniparamsContainer) destinationCfgOf(name string) destinationCfg {
+	c, ok := i.GislackCfg.Destinations[name]
+	if !ok {
+		c.Type = name
+	}
+	return c
+}
+
+// destIDs : Parse IDs of destinations given as "name=id,name=id".
+func destIDs(v string) (map[string]string, error) {
+	ids := map[string]string{}
+	for _, e := range strings.Split(v, ",") {
+		if e = strings.TrimSpace(e); len(e) == 0 {
+			continue
+		}
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 || len(kv[1]) == 0 {
+			return nil, fmt.Errorf("'%s' is not 'destination=id'", e)
+		}
+		ids[kv[0]] = kv[1]
+	}
+	return ids, nil
+}
+
+// destPayload : Create a payload from title, initialcomment, public, file and filename.
+func (j *jsonControl) destPayload(workdir string) *destPayload {
+	p := &destPayload{
+		Title:   j.Options["title"].(string),
+		Comment: j.Options["initialcomment"].(string),
+		Public:  j.Options["public"].(bool),
+	}
+	files := doubleFiles(j.Options["file"].(string))
+	names := doubleFiles(j.Options["filename"].(string))
+	for n, f := range files {
+		fpath := f
+		if filepath.Dir(f) == "." {
+			fpath = filepath.Join(workdir, f)
+		}
+		data, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		name := filepath.Base(f)
+		if len(names) >= len(files) {
+			name = names[n]
+		}
+		p.Files = append(p.Files, destFile{Name: name, Data: data})
+	}
+	return p
+}
+
+// submitToDestinations : Submit files to all destinations of "to" under parallel process.
+// When "update" has an ID for a destination, the destination is updated instead of new submission.
+func (i *iniparamsContainer) submitToDestinations() {
+	ds := i.destinations(i.jsonControl.Options["to"].(string))
+	update, _ := i.jsonControl.Options["update"].(string)
+	updates, err := destIDs(update)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v. Please use '--update' like 'gist=gistID'.\n", err)
+		os.Exit(1)
+	}
+	for name := range updates {
+		var found bool
+		for _, d := range ds {
+			found = found || d.Name() == name
+		}
+		if !found {
+			fmt.Fprintf(os.Stderr, "Error: Destination '%s' of '--update' is not included in '--to'.\n", name)
+			os.Exit(1)
+		}
+	}
+	p := i.jsonControl.destPayload(i.WorkDir)
+	if len(p.Files) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: Please input files using '-f'.\n")
+		os.Exit(1)
+	}
+	res := &destResults{
+		Results: make([]destResult, len(ds)),
+	}
+	var wg sync.WaitGroup
+	for n, d := range ds {
+		wg.Add(1)
+		go func(n int, d Destination) {
+			defer wg.Done()
+			start := time.Now()
+			var r destResult
+			if id, ok := updates[d.Name()]; ok {
+				r = d.Update(id, p)
+			} else {
+				r = d.Submit(p)
+			}
+			r.Et = math.Trunc(time.Since(start).Seconds()*1000) / 1000
+			res.Results[n] = r
+		}(n, d)
+	}
+	wg.Wait()
+	res.TotalEt = math.Trunc(time.Since(i.pstart).Seconds()*1000) / 1000
+	i.destRecord(res)
+	res.disp(i.jsonControl)
+}
+
+// disp : Display results of destinations. When a destination failed, this exits with 1.
+func (r *destResults) disp(j *jsonControl) {
+	if j.Options["simpleresult"].(bool) {
+		for _, e := range r.Results {
+			result, _ := json.Marshal(struct {
+				Destination string `json:"destination"`
+				ID          string `json:"id"`
+				OK          bool   `json:"ok"`
+			}{e.Destination, e.ID, e.OK})
+			fmt.Println(string(result))
+		}
+	} else {
+		var result []byte
+		if j.Options["jsonparser"].(bool) {
+			result, _ = json.MarshalIndent(r, "", "  ")
+		} else {
+			result, _ = json.Marshal(r)
+		}
+		fmt.Println(string(result))
+	}
+	for _, e := range r.Results {
+		if !e.OK {
+			os.Exit(1)
+		}
+	}
+}
+
+// destFetch : Request to a destination. The status code and the response are included in the result also when the request failed.
+// The body is returned only when the request succeeded.
+func destFetch(name, typ, action string, r *utl.RequestParams) (destResult, []byte) {
+	res := destResult{
+		Destination: name,
+		Type:        typ,
+		Action:      action,
+	}
+	hr, err := r.FetchAPIres()
+	if err != nil {
+		res.Error = err.Error()
+		return res, nil
+	}
+	defer hr.Body.Close()
+	res.StatusCode = hr.StatusCode
+	body, err := ioutil.ReadAll(hr.Body)
+	if json.Valid(body) {
+		res.Response = body
+	}
+	switch {
+	case err != nil:
+		res.Error = err.Error()
+		return res, nil
+	case hr.StatusCode-300 >= 0:
+		res.Error = fmt.Sprintf("Status Code: %d, %s", hr.StatusCode, strings.TrimSpace(string(body)))
+		return res, nil
+	}
+	res.OK = true
+	return res, body
+}
+
+// mergeStatus : Status code of several requests. The status code of the last failed request is used, and otherwise that of the last request is used.
+func (r *destResult) mergeStatus(e destResult) {
+	if e.StatusCode-300 >= 0 || r.StatusCode-300 < 0 {
+		r.StatusCode = e.StatusCode
+	}
+}
+
+// destResponses : Merge responses of several requests. A single response is used as it is.
+func destResponses(responses []json.RawMessage) json.RawMessage {
+	switch len(responses) {
+	case 0:
+		return nil
+	case 1:
+		return responses[0]
+	}
+	b, _ := json.Marshal(responses)
+	return b
+}
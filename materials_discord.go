@@ -0,0 +1,231 @@
+// Package main (materials_discord.go) :
+// Materials for Discord. Files are posted as attachments using a bot token or a webhook.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tanaikech/gislack/utl"
+)
+
+const (
+	discordurl = "https://discord.com/api/v10/"
+	// discordMaxContent : Maximum length of content of a message
+	discordMaxContent = 2000
+)
+
+// discordDest : A channel of Discord as a destination. ID of results is the message ID.
+// When webhookURL is used, the bot token is not required, but files cannot be listed.
+type discordDest struct {
+	name       string
+	botToken   string
+	channelID  string
+	webhookURL string
+}
+
+// discordMessage : Message of Discord
+type discordMessage struct {
+	ID        string    `json:"id"`
+	ChannelID string    `json:"channel_id"`
+	GuildID   string    `json:"guild_id,omitempty"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+	Author    struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	Attachments []struct {
+		ID       string `json:"id"`
+		Filename string `json:"filename"`
+		Size     int64  `json:"size"`
+		URL      string `json:"url"`
+	} `json:"attachments"`
+}
+
+// newDiscordDest : Create a destination of Discord. "webhook" of the destination is a URL or a name in 'discord.webhooks' of gislack.cfg.
+// When "webhook" is not used, "token" and "channel" are used as the bot token and the channel ID.
+func newDiscordDest(i *iniparamsContainer, name string, c destinationCfg) (Destination, error) {
+	d := &discordDest{
+		name:      name,
+		botToken:  i.GislackCfg.Discord.BotToken,
+		channelID: c.Channel,
+	}
+	if len(c.Webhook) > 0 {
+		d.webhookURL = c.Webhook
+		if !strings.Contains(c.Webhook, "://") {
+			u, ok := i.GislackCfg.Discord.Webhooks[c.Webhook]
+			if !ok || len(u) == 0 {
+				return nil, fmt.Errorf("Webhook '%s' is not found in 'discord.webhooks' of %s", c.Webhook, cfgFile)
+			}
+			d.webhookURL = u
+		}
+		if u, err := url.Parse(d.webhookURL); err != nil || len(u.Host) == 0 {
+			return nil, fmt.Errorf("Webhook URL '%s' is wrong", d.webhookURL)
+		}
+		return d, nil
+	}
+	if len(c.Token) > 0 {
+		d.botToken = c.Token
+	}
+	if len(d.botToken) == 0 {
+		return nil, fmt.Errorf("Bot token of Discord is NOT found. Please run 'gislack auth --discordtoken token', or use a webhook")
+	}
+	if len(d.channelID) == 0 {
+		d.channelID, _ = i.jsonControl.Options["channel"].(string)
+	}
+	if len(d.channelID) == 0 {
+		return nil, fmt.Errorf("Channel ID is NOT found. Please use '-ch' or 'channel' of the destination in %s", cfgFile)
+	}
+	return d, nil
+}
+
+// Name : Name of the destination
+func (d *discordDest) Name() string {
+	return d.name
+}
+
+// messagesURL : URL of messages. When id is empty, the URL for creating a message is returned.
+// The query of the webhook URL like "thread_id" is kept.
+func (d *discordDest) messagesURL(id string) string {
+	if len(d.webhookURL) > 0 {
+		u, _ := url.Parse(d.webhookURL)
+		q := u.Query()
+		u.Path = strings.TrimRight(u.Path, "/")
+		if len(id) == 0 {
+			q.Set("wait", "true")
+		} else {
+			u.Path += "/messages/" + id
+		}
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	u := discordurl + "channels/" + d.channelID + "/messages"
+	if len(id) > 0 {
+		u += "/" + id
+	}
+	return u
+}
+
+// request : Request to Discord, and set ID and URL of the message to the result.
+func (d *discordDest) request(action, method, id string, data io.Reader, contenttype string) destResult {
+	r := &utl.RequestParams{
+		Method:      method,
+		APIURL:      d.messagesURL(id),
+		Data:        data,
+		Contenttype: contenttype,
+		Dtime:       10,
+	}
+	if len(d.webhookURL) == 0 {
+		r.Authorization = "Bot " + d.botToken
+	}
+	res, body := destFetch(d.name, "discord", action, r)
+	res.ID = id
+	if body != nil {
+		var m discordMessage
+		json.Unmarshal(body, &m)
+		if len(m.ID) > 0 {
+			res.ID = m.ID
+			if len(m.GuildID) > 0 {
+				res.URL = "https://discord.com/channels/" + m.GuildID + "/" + m.ChannelID + "/" + m.ID
+			} else if len(m.Attachments) > 0 {
+				res.URL = m.Attachments[0].URL
+			}
+		}
+	}
+	return res
+}
+
+// message : Create a multipart body with the message and the attachments.
+func (d *discordDest) message(p *destPayload, replace bool) (io.Reader, string, error) {
+	content := chatMessage(p)
+	if r := []rune(content); len(r) > discordMaxContent {
+		content = string(r[:discordMaxContent-3]) + "..."
+	}
+	payload := map[string]interface{}{
+		"content": content,
+	}
+	if replace {
+		// Discord keeps only the attachments listed in "attachments" on an edit, so the uploaded files are listed with their indexes of "files[n]".
+		attachments := []map[string]interface{}{}
+		for n, f := range p.Files {
+			attachments = append(attachments, map[string]interface{}{"id": n, "filename": f.Name})
+		}
+		payload["attachments"] = attachments
+	}
+	pj, _ := json.Marshal(payload)
+	b, ctype, err := chatMultipart(map[string]string{"payload_json": string(pj)}, p.Files, func(n int) string {
+		return "files[" + strconv.Itoa(n) + "]"
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return b, ctype, nil
+}
+
+// Submit : Post the message with the files as attachments.
+func (d *discordDest) Submit(p *destPayload) destResult {
+	b, ctype, err := d.message(p, false)
+	if err != nil {
+		return destResult{Destination: d.name, Type: "discord", Action: "submit", Error: err.Error()}
+	}
+	return d.request("submit", "POST", "", b, ctype)
+}
+
+// Update : Edit the message. The attachments are replaced by the files.
+func (d *discordDest) Update(id string, p *destPayload) destResult {
+	b, ctype, err := d.message(p, true)
+	if err != nil {
+		return destResult{Destination: d.name, Type: "discord", Action: "update", ID: id, Error: err.Error()}
+	}
+	return d.request("update", "PATCH", id, b, ctype)
+}
+
+// Delete : Delete a message. The attachments are also deleted.
+func (d *discordDest) Delete(id string) destResult {
+	return d.request("delete", "DELETE", id, nil, "")
+}
+
+// Get : Retrieve a message.
+func (d *discordDest) Get(id string) destResult {
+	return d.request("get", "GET", id, nil, "")
+}
+
+// Files : Retrieve attachments from the latest 100 messages of the channel. This requires the bot token.
+func (d *discordDest) Files() ([]chatFile, error) {
+	if len(d.webhookURL) > 0 {
+		return nil, fmt.Errorf("Files cannot be retrieved by a webhook. Please use the bot token")
+	}
+	r := &utl.RequestParams{
+		Method:        "GET",
+		APIURL:        d.messagesURL("") + "?limit=100",
+		Data:          nil,
+		Authorization: "Bot " + d.botToken,
+		Dtime:         10,
+	}
+	body, err := r.FetchAPI()
+	if err != nil {
+		return nil, fmt.Errorf("%v, %s", err, strings.TrimSpace(string(body)))
+	}
+	var ms []discordMessage
+	json.Unmarshal(body, &ms)
+	var files []chatFile
+	for _, m := range ms {
+		for _, a := range m.Attachments {
+			files = append(files, chatFile{
+				ID:          a.ID,
+				Name:        a.Filename,
+				MessageID:   m.ID,
+				User:        m.Author.Username,
+				Size:        a.Size,
+				URL:         a.URL,
+				CreatedTime: m.Timestamp.In(time.Local),
+			})
+		}
+	}
+	return files, nil
+}
@@ -3,17 +3,15 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"math"
-	"mime/multipart"
-	"net/textproto"
-	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,218 +20,603 @@ import (
 
 // doubleParam : Parameter for double submissions
 type doubleParam struct {
-	GistS       *utl.RequestParams
-	SlackS      *utl.RequestParams
+	Requests    []doubleRequest
 	Pstart      time.Time
 	JSONControl *jsonControl
 }
 
+// doubleRequest : A request for a destination of double submissions. The payload is submitted through Dest, and when ID is used, ID is updated.
+type doubleRequest struct {
+	Destination string
+	Workspace   string
+	Channel     string
+	File        string
+	ID          string
+	Dest        Destination
+	Payload     *destPayload
+}
+
+// doubleResponse : A response from a destination of double submissions
+type doubleResponse struct {
+	Destination string  `json:"destination"`
+	File        string  `json:"file,omitempty"`
+	StatusCode  int     `json:"status_code,omitempty"`
+	Body        string  `json:"body,omitempty"`
+	Error       string  `json:"error,omitempty"`
+	Et          float64 `json:"ElapsedTime"`
+	workspace   string
+	channel     string
+}
+
 // doubleResults : Results from double submissions
 type doubleResults struct {
-	Gist    gistGetList   `json:"gist_response"`
-	Slack   slackFileList `json:"slack_response"`
-	TotalEt float64       `json:"TotalElapsedTime,omitempty"`
+	Gist     gistGetList      `json:"gist_response"`
+	Slack    slackFileList    `json:"slack_response"`
+	Slacks   []slackFileList  `json:"slack_responses,omitempty"`
+	Webhook  *webhookResult   `json:"webhook_response,omitempty"`
+	Files    []doubleFile     `json:"files,omitempty"`
+	Rollback []doubleRollback `json:"rollback,omitempty"`
+	Replaced []doubleRollback `json:"replaced,omitempty"`
+	Errors   []doubleResponse `json:"errors,omitempty"`
+	GistEt   float64          `json:"GistElapsedTime,omitempty"`
+	SlackEt  float64          `json:"SlackElapsedTime,omitempty"`
+	TotalEt  float64          `json:"TotalElapsedTime,omitempty"`
+}
+
+// doubleRollback : Result of a rollback for "atomic", or a deletion of the replaced file for "slack-update"
+type doubleRollback struct {
+	Target string `json:"target"`
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+}
+
+// doubleFile : Result of each file for double submissions of several files
+type doubleFile struct {
+	File         string   `json:"file"`
+	GistFilename string   `json:"gist_filename,omitempty"`
+	GistRawURL   string   `json:"gist_raw_url,omitempty"`
+	SlackFileIDs []string `json:"slack_file_ids,omitempty"`
+	Error        string   `json:"error,omitempty"`
 }
 
-// doubleSubmitInit : Initialize doubleParam
-func (p *iniparamsContainer) doubleSubmitInit(g, s *utl.RequestParams) *doubleParam {
-	return &doubleParam{
-		GistS:       g,
-		SlackS:      s,
+// doubleSubmitInit : Initialize doubleParam. When g is nil, only s is submitted.
+func (p *iniparamsContainer) doubleSubmitInit(g *doubleRequest, s []doubleRequest) *doubleParam {
+	d := &doubleParam{
 		Pstart:      p.pstart,
 		JSONControl: p.jsonControl,
 	}
+	if g != nil {
+		d.Requests = append(d.Requests, *g)
+	}
+	d.Requests = append(d.Requests, s...)
+	return d
+}
+
+// doubleLinkTemplate : Default template of the initial comment for "link".
+const doubleLinkTemplate = "{comment}\nGist: {url}\nRevision: {revision}"
+
+// doubleSubmitDo : Submit to Gist and Slack. The incoming webhook, the sequential submission with "link" or the parallel submission is used.
+func (p *iniparamsContainer) doubleSubmitDo(g *doubleRequest, s *slackContainer) {
+	link, _ := p.jsonControl.Options["link"].(bool)
+	var snapshot *gistGetList
+	if atomic, _ := p.jsonControl.Options["atomic"].(bool); atomic {
+		snapshot = p.gistSnapshot()
+	}
+	switch {
+	case s.slackWebhookMode():
+		p.doubleSubmitWebhook(g, s, snapshot)
+	case len(p.slackUpdateMode()) > 0:
+		p.doubleSubmitUpdate(p.slackUpdateMode(), g, s, snapshot)
+	case link:
+		p.doubleSubmitLinked(g, s, snapshot)
+	default:
+		res := p.doubleSubmitInit(g, s.slackDoubleRequests()).doubleSubmitting()
+		p.doubleSubmittingDisp(res, snapshot)
+	}
+}
+
+// doubleSubmitLinked : Submit to Gist at first, and then submit to Slack with the initial comment including the URL of the gist.
+func (p *iniparamsContainer) doubleSubmitLinked(g *doubleRequest, s *slackContainer, snapshot *gistGetList) {
+	s.slackResolveDestinations()
+	gr := doubleFetch(*g)
+	var gg gistGetList
+	json.Unmarshal([]byte(gr.Body), &gg)
+	if len(gr.Error) > 0 || gg.ID == "" {
+		fmt.Fprintf(os.Stderr, "Error: The file couldn't submit to Gist. Nothing was submitted to Slack. %s, %s\n", gr.Error, gr.Body)
+		os.Exit(1)
+	}
+	tmpl, _ := p.jsonControl.Options["template"].(string)
+	if len(tmpl) == 0 {
+		tmpl = doubleLinkTemplate
+	}
+	p.jsonControl.Options["initialcomment"] = gistLinkComment(tmpl, p.jsonControl.Options["initialcomment"].(string), gg)
+	res := p.doubleSubmitInit(nil, s.slackDoubleRequests()).doubleSubmitting()
+	p.doubleSubmittingDisp(append([]doubleResponse{gr}, res...), snapshot)
+}
+
+// gistLinkComment : Create a comment from a template.
+// "{url}", "{id}", "{revision}", "{description}" and "{comment}" are replaced by the values of the gist and the initial comment.
+func gistLinkComment(tmpl, comment string, g gistGetList) string {
+	var revision string
+	if len(g.History) > 0 {
+		revision = g.History[0].Version
+	}
+	r := strings.NewReplacer(
+		"\\n", "\n",
+		"{url}", g.HTMLURL,
+		"{id}", g.ID,
+		"{revision}", revision,
+		"{description}", g.Description,
+		"{comment}", comment,
+	)
+	return strings.TrimSpace(r.Replace(tmpl))
 }
 
-// doubleSubmitting : Do double submissions under parallel process
-func (d *doubleParam) doubleSubmitting() map[string]interface{} {
+// doubleSubmitting : Do double submissions under parallel process.
+// Each response is sent to a channel with the index of the request, so the order of responses is the same as the requests.
+func (d *doubleParam) doubleSubmitting() []doubleResponse {
+	type indexed struct {
+		i int
+		r doubleResponse
+	}
 	var wg sync.WaitGroup
-	submit := make(chan *utl.RequestParams, 2)
-	workers := 2
-	var res [][]byte
-	for i := 0; i < workers; i++ {
+	ch := make(chan indexed, len(d.Requests))
+	for i, e := range d.Requests {
 		wg.Add(1)
-		go func(wg *sync.WaitGroup, submit chan *utl.RequestParams) {
+		go func(i int, e doubleRequest) {
 			defer wg.Done()
-			for {
-				p, done := <-submit
-				if !done {
-					return
-				}
-				body, err := p.FetchAPI()
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error: %+v, %s\n", string(body), err)
-					return
+			ch <- indexed{i, doubleFetch(e)}
+		}(i, e)
+	}
+	wg.Wait()
+	close(ch)
+	res := make([]doubleResponse, len(d.Requests))
+	for e := range ch {
+		res[e.i] = e.r
+	}
+	return res
+}
+
+// doubleFetch : Submit the payload to the destination, and return the response with the elapsed time.
+func doubleFetch(e doubleRequest) doubleResponse {
+	r := doubleResponse{
+		Destination: e.Destination,
+		File:        e.File,
+		workspace:   e.Workspace,
+		channel:     e.Channel,
+	}
+	start := time.Now()
+	var res destResult
+	if len(e.ID) > 0 {
+		res = e.Dest.Update(e.ID, e.Payload)
+	} else {
+		res = e.Dest.Submit(e.Payload)
+	}
+	r.StatusCode = res.StatusCode
+	r.Body = string(res.Response)
+	r.Error = res.Error
+	r.Et = math.Trunc(time.Since(start).Seconds()*1000) / 1000
+	return r
+}
+
+// gistDoubleRequest : Request to Gist through gistDest. Several files separated by "," are submitted as one gist.
+// When "updateoverwrite" or "updateadd" is used, the gist is updated. For "updateoverwrite", the files of the gist which are not submitted are removed.
+func (g *gistContainer) gistDoubleRequest() *doubleRequest {
+	p := g.jsonControl.destPayload(g.workdir)
+	id, _ := g.jsonControl.Options["updateadd"].(string)
+	if overwrite, _ := g.jsonControl.Options["updateoverwrite"].(string); len(overwrite) > 0 {
+		id = overwrite
+		submitted := map[string]bool{}
+		for _, f := range p.Files {
+			submitted[f.Name] = true
+		}
+		for _, e := range g.gistGetMain(id).GistGetList {
+			for name := range e.Files {
+				if !submitted[name] {
+					p.Remove = append(p.Remove, name)
 				}
-				res = append(res, body)
 			}
-		}(&wg, submit)
+		}
 	}
-	submit <- d.GistS
-	submit <- d.SlackS
-	close(submit)
-	wg.Wait()
-	return map[string]interface{}{
-		"r1": res,
-		"r2": d.Pstart,
+	return &doubleRequest{
+		Destination: "gist",
+		ID:          id,
+		Dest:        &gistDest{name: "gist", accesstoken: g.Accesstoken},
+		Payload:     p,
 	}
 }
 
-// gistSubmit : Request to Gist
-func (g *gistContainer) gistSubmitReq() *utl.RequestParams {
-	var err error
-	g.GistPayload.Description = g.jsonControl.Options["title"].(string)
-	g.GistPayload.Public = g.jsonControl.Options["public"].(bool)
-	if err != nil {
-		panic(err)
+// slackDoubleRequests : Requests to Slack. A request is created for each channel of the destinations, so the result is given for each channel.
+// When several files are used, a request is created for each file ("each"), or the files are submitted as a zip file ("zip") or a combined file ("combined").
+func (s *slackContainer) slackDoubleRequests() []doubleRequest {
+	dests := s.slackResolveDestinations()
+	files := doubleFiles(s.jsonControl.Options["file"].(string))
+	mode, _ := s.jsonControl.Options["slackmode"].(string)
+	var rs []doubleRequest
+	switch {
+	case len(files) > 1 && (mode == "zip" || mode == "combined"):
+		f, err := s.slackPackFiles(mode, files)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		p := s.slackDestPayload()
+		p.Files = []destFile{f}
+		for _, d := range dests {
+			rs = append(rs, d.doubleRequests("", p)...)
+		}
+	case len(mode) == 0 || mode == "each":
+		for _, file := range files {
+			f, err := s.slackReadFile(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			p := s.slackDestPayload()
+			p.Files = []destFile{f}
+			for _, d := range dests {
+				rs = append(rs, d.doubleRequests(file, p)...)
+			}
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: '%s' is not a supported mode. Please use 'each', 'zip' or 'combined'.\n", mode)
+		os.Exit(1)
+	}
+	return rs
+}
+
+// doubleRequests : Create requests of double submissions for each channel of the destination.
+func (d *slackDestination) doubleRequests(file string, p *destPayload) []doubleRequest {
+	dest := "slack"
+	if len(d.Workspace) > 0 {
+		dest += ":" + d.Workspace
+	}
+	var rs []doubleRequest
+	for n, e := range d.dests() {
+		rs = append(rs, doubleRequest{
+			Destination: dest,
+			Workspace:   d.Workspace,
+			Channel:     d.Channels[n],
+			File:        file,
+			Dest:        e,
+			Payload:     p,
+		})
+	}
+	return rs
+}
+
+// doubleFiles : Split files separated by ",".
+func doubleFiles(files string) []string {
+	var ar []string
+	for _, e := range strings.Split(files, ",") {
+		if e = strings.TrimSpace(e); len(e) > 0 {
+			ar = append(ar, e)
+		}
 	}
-	g.GistPayload.Files = func(f string) map[string]interface{} {
-		obj := map[string]interface{}{}
-		var fpath string
+	return ar
+}
+
+// slackPackFiles : Pack files to a zip file or a combined text file for Slack.
+func (s *slackContainer) slackPackFiles(mode string, files []string) (destFile, error) {
+	name := strings.TrimSpace(s.jsonControl.Options["title"].(string))
+	if len(name) == 0 {
+		name = appname
+	}
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	var b bytes.Buffer
+	var zw *zip.Writer
+	if mode == "zip" {
+		zw = zip.NewWriter(&b)
+	}
+	for _, f := range files {
+		fpath := f
 		if filepath.Dir(f) == "." {
-			fpath = filepath.Join(g.workdir, f)
-		} else {
-			fpath = f
+			fpath = filepath.Join(s.workdir, f)
 		}
 		data, err := ioutil.ReadFile(fpath)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-			os.Exit(1)
+			return destFile{}, err
 		}
-		value := map[string]interface{}{
-			"content": string(data),
+		if zw == nil {
+			fmt.Fprintf(&b, "==> %s <==\n%s\n\n", filepath.Base(f), strings.TrimRight(string(data), "\n"))
+			continue
+		}
+		w, err := zw.Create(filepath.Base(f))
+		if err != nil {
+			return destFile{}, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return destFile{}, err
 		}
-		obj[filepath.Base(f)] = value
-		return obj
-	}(g.jsonControl.Options["file"].(string))
-	payload, _ := json.Marshal(g.GistPayload)
-	r := &utl.RequestParams{
-		Method:      "POST",
-		APIURL:      gisturl,
-		Data:        bytes.NewBuffer(payload),
-		Contenttype: "application/x-www-form-urlencoded",
-		Accesstoken: g.Accesstoken,
-		Dtime:       10,
 	}
-	return r
+	if zw == nil {
+		return destFile{Name: name + ".txt", Data: b.Bytes()}, nil
+	}
+	if err := zw.Close(); err != nil {
+		return destFile{}, err
+	}
+	return destFile{Name: name + ".zip", Data: b.Bytes()}, nil
 }
 
-// slackSubmit : Request to Slack
-func (s *slackContainer) slackSubmitReq() *utl.RequestParams {
-	s.slackParams.SlackPayload.Title = s.jsonControl.Options["title"].(string)
-	s.slackParams.SlackPayload.Filetype = s.jsonControl.Options["filetype"].(string)
-	s.slackParams.SlackPayload.Channels = s.slackGetChannels().slackChannelNameToID()
-	s.slackParams.SlackPayload.InitialComment = s.jsonControl.Options["initialcomment"].(string)
-	s.slackParams.SlackPayload.Filename = s.jsonControl.Options["file"].(string)
-	var file string
-	if filepath.Dir(s.slackParams.SlackPayload.Filename) == "." {
-		file = filepath.Join(s.workdir, s.slackParams.SlackPayload.Filename)
+// doubleSubmittingDisp : Display results. Responses are classified by their destinations.
+func (p *iniparamsContainer) doubleSubmittingDisp(res []doubleResponse, snapshot *gistGetList) {
+	d := &doubleResults{}
+	var slackFiles []string
+	for _, e := range res {
+		if e.Destination == "gist" {
+			d.GistEt = e.Et
+			if len(e.Error) == 0 {
+				json.Unmarshal([]byte(e.Body), &d.Gist)
+			}
+			if d.Gist.ID == "" {
+				d.Errors = append(d.Errors, e)
+			}
+			continue
+		}
+		d.SlackEt = math.Max(d.SlackEt, e.Et)
+		var sl slackFileList
+		json.Unmarshal([]byte(e.Body), &sl)
+		if len(e.Error) > 0 && len(sl.Error) == 0 {
+			sl.Error = e.Error
+		}
+		if sl.OK {
+			sl.File.CreatedTime = time.Unix(sl.File.Created, 0)
+		} else {
+			d.Errors = append(d.Errors, e)
+		}
+		sl.Workspace = e.workspace
+		sl.Channel = e.channel
+		d.Slacks = append(d.Slacks, sl)
+		slackFiles = append(slackFiles, e.File)
+	}
+	if len(d.Slacks) > 0 {
+		d.Slack = d.Slacks[0]
+	}
+	if atomic, _ := p.jsonControl.Options["atomic"].(bool); atomic && d.doublePartial() {
+		d.Rollback = p.doubleRollbackAll(d, snapshot)
+	}
+	if len(d.Rollback) == 0 && p.slackUpdateMode() == "replace" {
+		d.Replaced = p.slackReplacePosts(d)
+	}
+	if files := doubleFiles(p.jsonControl.Options["file"].(string)); len(files) > 1 {
+		d.doubleFileResults(files, p.jsonControl.Options["filename"].(string), slackFiles)
+	}
+	p.doubleRecord(d)
+	failed := d.Gist.ID == ""
+	for _, e := range d.Slacks {
+		failed = failed && !e.OK
+	}
+	if len(d.Slacks) < 2 {
+		d.Slacks = nil
+	}
+	if failed {
+		fmt.Fprintf(os.Stderr, "Error: The file couldn't submit to Gist and Slack.\n")
+	}
+	if d.Gist.ID != "" {
+		d.Gist.CreatedAt = d.Gist.CreatedAt.In(time.Local)
+		d.Gist.UpdatedAt = d.Gist.UpdatedAt.In(time.Local)
+	}
+	if p.jsonControl.Options["simpleresult"].(bool) {
+		d.simpleResult()
 	} else {
-		file = s.slackParams.SlackPayload.Filename
-	}
-	p := url.Values{}
-	p.Set("token", s.Token)
-	p.Set("channels", s.slackParams.SlackPayload.Channels)
-	p.Set("title", s.slackParams.SlackPayload.Title)
-	p.Set("filetype", s.slackParams.SlackPayload.Filetype)
-	p.Set("initial_comment", s.slackParams.SlackPayload.InitialComment)
-	p.Set("filename", filepath.Base(file))
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
-	part := make(textproto.MIMEHeader)
-	data, err := w.CreatePart(part)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v. ", err)
-		os.Exit(1)
+		d.TotalEt = math.Trunc(time.Now().Sub(p.pstart).Seconds()*1000) / 1000
+		var result []byte
+		if p.jsonControl.Options["jsonparser"].(bool) {
+			result, _ = json.MarshalIndent(d, "", "  ")
+		} else {
+			result, _ = json.Marshal(d)
+		}
+		fmt.Println(string(result))
 	}
-	fs, err := os.Open(file)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v. ", err)
+	if failed || len(d.Rollback) > 0 {
 		os.Exit(1)
 	}
-	defer fs.Close()
-	data, err = w.CreateFormFile("file", file)
+	return
+}
+
+// doublePartial : Check whether only a part of the submissions succeeded.
+func (d *doubleResults) doublePartial() bool {
+	ok := d.Gist.ID != ""
+	ng := d.Gist.ID == ""
+	for _, e := range d.Slacks {
+		ok = ok || e.OK
+		ng = ng || !e.OK
+	}
+	return ok && ng
+}
+
+// gistSnapshot : Retrieve the gist before updating for the rollback. For a new gist, nil is returned.
+func (p *iniparamsContainer) gistSnapshot() *gistGetList {
+	id := p.gistUpdateID()
+	if len(id) == 0 {
+		return nil
+	}
+	g, err := gistSnapshotOf(p.GislackCfg.Gist.GistAccesstoken.Accesstoken, id)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v. ", err)
+		fmt.Fprintf(os.Stderr, "Error: gist ID '%s' couldn't be retrieved for the rollback. Nothing was submitted.\n%v\n", id, err)
 		os.Exit(1)
 	}
-	if _, err = io.Copy(data, fs); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v. ", err)
-		os.Exit(1)
+	return g
+}
+
+// gistUpdateID : ID of the gist updated by "updateoverwrite" or "updateadd". For a new gist, "" is returned.
+func (p *iniparamsContainer) gistUpdateID() string {
+	id, _ := p.jsonControl.Options["updateoverwrite"].(string)
+	if len(id) == 0 {
+		id, _ = p.jsonControl.Options["updateadd"].(string)
 	}
-	w.Close()
+	return id
+}
+
+// gistSnapshotOf : Retrieve a gist with the contents of all files. id can be "gistID/revision" for retrieving the revision.
+func gistSnapshotOf(token, id string) (*gistGetList, error) {
 	r := &utl.RequestParams{
-		Method:      "POST",
-		APIURL:      slackurl + "files.upload?" + p.Encode(),
-		Data:        &b,
-		Contenttype: w.FormDataContentType(),
-		Accesstoken: s.Token,
+		Method:      "GET",
+		APIURL:      gisturl + "/" + id,
+		Data:        nil,
+		Contenttype: "application/x-www-form-urlencoded",
+		Accesstoken: token,
 		Dtime:       10,
 	}
-	return r
-}
-
-// doubleSubmittingDisp : Display results
-func (p *iniparamsContainer) doubleSubmittingDisp(ar map[string]interface{}) {
-	res, _ := ar["r1"].([][]byte)
-	d := &doubleResults{}
-	if json.Unmarshal(res[0], &d.Gist); d.Gist.ID != "" {
-		json.Unmarshal(res[1], &d.Slack)
-	} else {
-		json.Unmarshal(res[0], &d.Slack)
-		json.Unmarshal(res[1], &d.Gist)
+	body, err := r.FetchAPI()
+	if err != nil {
+		return nil, err
 	}
-	if d.Gist.ID == "" && !d.Slack.OK {
-		fmt.Printf("Error: The file couldn't submit to Gist and Slack.\n")
-		os.Exit(1)
+	var g gistGetList
+	json.Unmarshal(body, &g)
+	for name, e := range g.Files {
+		f, _ := e.(map[string]interface{})
+		if truncated, _ := f["truncated"].(bool); !truncated {
+			continue
+		}
+		raw, _ := f["raw_url"].(string)
+		r := &utl.RequestParams{
+			Method:      "GET",
+			APIURL:      raw,
+			Data:        nil,
+			Accesstoken: token,
+			Dtime:       10,
+		}
+		content, err := r.FetchAPI()
+		if err != nil {
+			return nil, fmt.Errorf("'%s' couldn't be retrieved. %v", name, err)
+		}
+		f["content"] = string(content)
 	}
+	return &g, nil
+}
+
+// doubleRollbackAll : Roll back the succeeded submissions. The created gist is deleted or the updated gist is reverted to snapshot, and the files submitted to Slack are deleted.
+func (p *iniparamsContainer) doubleRollbackAll(d *doubleResults, snapshot *gistGetList) []doubleRollback {
+	var rb []doubleRollback
 	if d.Gist.ID != "" {
-		d.Gist.CreatedAt = d.Gist.CreatedAt.In(time.Local)
-		d.Gist.UpdatedAt = d.Gist.UpdatedAt.In(time.Local)
+		rb = append(rb, p.gistRollback(d.Gist, snapshot))
 	}
-	if d.Slack.OK {
-		d.Slack.File.CreatedTime = time.Unix(d.Slack.File.Created, 0)
+	for _, e := range d.Slacks {
+		if !e.OK {
+			continue
+		}
+		r := doubleRollback{
+			Target: "slack",
+			ID:     e.File.ID,
+			Action: "delete",
+		}
+		res := (&slackDest{name: "slack", token: p.slackTokenOf(e.Workspace)}).Delete(e.File.ID)
+		r.OK = res.OK
+		r.Error = res.Error
+		rb = append(rb, r)
 	}
-	if p.jsonControl.Options["simpleresult"].(bool) {
-		d.simpleResult()
-		return
+	return rb
+}
+
+// gistRollback : Delete the created gist, or revert the updated gist to snapshot.
+func (p *iniparamsContainer) gistRollback(g gistGetList, snapshot *gistGetList) doubleRollback {
+	r := doubleRollback{
+		Target: "gist",
+		ID:     g.ID,
+		Action: "delete",
 	}
-	pstime, _ := ar["r2"].(time.Time)
-	d.TotalEt = math.Trunc(time.Now().Sub(pstime).Seconds()*1000) / 1000
-	var result []byte
-	if p.jsonControl.Options["jsonparser"].(bool) {
-		result, _ = json.MarshalIndent(d, "", "  ")
+	d := &gistDest{name: "gist", accesstoken: p.GislackCfg.Gist.GistAccesstoken.Accesstoken}
+	var res destResult
+	if snapshot == nil {
+		res = d.Delete(g.ID)
 	} else {
-		result, _ = json.Marshal(d)
+		r.Action = "revert"
+		files := map[string]interface{}{}
+		for name := range g.Files {
+			files[name] = nil
+		}
+		for name, e := range snapshot.Files {
+			f, _ := e.(map[string]interface{})
+			files[name] = map[string]interface{}{"content": f["content"]}
+		}
+		res = d.request("revert", "PATCH", g.ID, &gistPayload{
+			Description: snapshot.Description,
+			Public:      snapshot.Public,
+			Files:       files,
+		})
 	}
-	fmt.Println(string(result))
-	return
+	r.OK = res.OK
+	r.Error = res.Error
+	return r
 }
 
-// simpleResult : Display simple results
+// doubleFileResults : Make results of each file from the results of Gist and Slack.
+// slackFiles is the submitted file of each result of Slack. When it is empty, all files were submitted as one file.
+func (d *doubleResults) doubleFileResults(files []string, filenames string, slackFiles []string) {
+	names := doubleFiles(filenames)
+	for i, f := range files {
+		df := doubleFile{
+			File:         f,
+			GistFilename: filepath.Base(f),
+		}
+		if len(names) >= len(files) {
+			df.GistFilename = names[i]
+		}
+		if gf, ok := d.Gist.Files[df.GistFilename].(map[string]interface{}); ok {
+			df.GistRawURL, _ = gf["raw_url"].(string)
+		} else {
+			df.Error = "The file couldn't submit to Gist."
+		}
+		for j, sl := range d.Slacks {
+			if sl.OK && (len(slackFiles[j]) == 0 || slackFiles[j] == f) {
+				df.SlackFileIDs = append(df.SlackFileIDs, sl.File.ID)
+			}
+		}
+		if len(df.SlackFileIDs) == 0 {
+			df.Error = strings.TrimSpace(df.Error + " The file couldn't submit to Slack.")
+		}
+		d.Files = append(d.Files, df)
+	}
+}
+
+// doubleSimpleResult : Simple result of double submissions for each channel of Slack. IDs which were deleted by the rollback are empty, and the rollback is included.
+type doubleSimpleResult struct {
+	GistCreatedAt  string           `json:"gist_created_at"`
+	GistID         string           `json:"gist_id"`
+	SlackCreatedAt string           `json:"slack_created_at"`
+	SlackID        string           `json:"slack_id"`
+	SlackWorkspace string           `json:"slack_workspace,omitempty"`
+	SlackChannel   string           `json:"slack_channel,omitempty"`
+	Rollback       []doubleRollback `json:"rollback,omitempty"`
+}
+
+// simpleResult : Display simple results. A line is displayed for each channel of Slack.
 func (d *doubleResults) simpleResult() {
-	fmt.Printf(
-		"{\"gist_created_at\": \"%s\", \"gist_id\": \"%s\", \"slack_created_at\": \"%s\", \"slack_id\": \"%s\"}\n",
-		func(d *doubleResults) string {
-			var outmsg string
-			if d.Gist.ID != "" {
-				outmsg = string(d.Gist.CreatedAt.Format("20060102_15:04:05"))
-			} else {
-				outmsg = "Error: The file couldn't submit."
+	slacks := d.Slacks
+	if len(slacks) == 0 {
+		slacks = []slackFileList{d.Slack}
+	}
+	for _, sl := range slacks {
+		r := doubleSimpleResult{
+			GistCreatedAt:  "Error: The file couldn't submit.",
+			GistID:         d.Gist.ID,
+			SlackCreatedAt: "Error: " + sl.Error,
+			SlackID:        sl.File.ID,
+			SlackWorkspace: sl.Workspace,
+			SlackChannel:   sl.Channel,
+			Rollback:       d.Rollback,
+		}
+		if d.Gist.ID != "" {
+			r.GistCreatedAt = d.Gist.CreatedAt.Format("20060102_15:04:05")
+		}
+		if sl.OK {
+			r.SlackCreatedAt = sl.File.CreatedTime.Format("20060102_15:04:05")
+		}
+		for _, e := range d.Rollback {
+			if !e.OK || e.Action != "delete" {
+				continue
 			}
-			return outmsg
-		}(d),
-		d.Gist.ID,
-		func(d *doubleResults) string {
-			var outmsg string
-			if d.Slack.OK {
-				outmsg = string(d.Slack.File.CreatedTime.Format("20060102_15:04:05"))
-			} else {
-				outmsg = "Error: " + d.Slack.Error
+			switch {
+			case e.Target == "gist" && e.ID == r.GistID:
+				r.GistID, r.GistCreatedAt = "", "Rolled back."
+			case e.Target == "slack" && e.ID == r.SlackID:
+				r.SlackID, r.SlackCreatedAt = "", "Rolled back."
 			}
-			return outmsg
-		}(d),
-		d.Slack.File.ID,
-	)
-	return
+		}
+		result, _ := json.Marshal(r)
+		fmt.Println(string(result))
+	}
 }
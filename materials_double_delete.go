@@ -0,0 +1,325 @@
+// Package main (materials_double_delete.go) :
+// Materials for deleting a submission from both Gist and Slack.
+// When only one of the gist ID and the Slack file ID is given, the counterpart is resolved from the ledger or by searching.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tanaikech/gislack/utl"
+)
+
+var (
+	// slackFileIDPattern : Pattern of file IDs of Slack. Gist IDs are lowercase hexadecimal.
+	slackFileIDPattern = regexp.MustCompile(`^F[A-Z0-9]+$`)
+	// gistURLPattern : Pattern of URLs of Gist for retrieving the gist ID from comments.
+	gistURLPattern = regexp.MustCompile(`gist\.github\.com/(?:[\w-]+/)?([0-9a-f]{20,})`)
+)
+
+// doubleDeleteResult : Result of deleting from both services
+type doubleDeleteResult struct {
+	GistID       string           `json:"gist_id,omitempty"`
+	SlackFileIDs []string         `json:"slack_file_ids,omitempty"`
+	ResolvedBy   string           `json:"resolved_by,omitempty"`
+	Results      []doubleRollback `json:"results"`
+	TotalEt      float64          `json:"TotalElapsedTime,omitempty"`
+}
+
+// doubleDeleteSimpleResult : Result of deleting from both services for "simpleresult"
+type doubleDeleteSimpleResult struct {
+	GistID       string `json:"gist_id"`
+	SlackFileIDs string `json:"slack_file_ids"`
+	OK           bool   `json:"ok"`
+}
+
+// doubleDeleteFile : A file of Slack to delete
+type doubleDeleteFile struct {
+	ID        string
+	Workspace string
+}
+
+// doubleDeleteIDs : Split "delete" to the gist ID and the Slack file ID.
+func doubleDeleteIDs(v string) (string, string, error) {
+	var gistID, fileID string
+	for _, e := range doubleFiles(v) {
+		switch {
+		case slackFileIDPattern.MatchString(e) && len(fileID) == 0:
+			fileID = e
+		case !slackFileIDPattern.MatchString(e) && len(gistID) == 0:
+			gistID = e
+		default:
+			return "", "", fmt.Errorf("Please input one gist ID and/or one Slack file ID like 'gistID,slackFileID'")
+		}
+	}
+	if len(gistID) == 0 && len(fileID) == 0 {
+		return "", "", fmt.Errorf("Please input a gist ID and/or a Slack file ID")
+	}
+	return gistID, fileID, nil
+}
+
+// doubleDelete : Delete the gist and the Slack files concurrently. The messages sharing the files are also deleted where possible.
+func (p *iniparamsContainer) doubleDelete() {
+	gistID, fileID, err := doubleDeleteIDs(p.jsonControl.Options["delete"].(string))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v.\n", err)
+		os.Exit(1)
+	}
+	d := &doubleDeleteResult{GistID: gistID}
+	var files []doubleDeleteFile
+	if len(fileID) > 0 {
+		files = append(files, doubleDeleteFile{ID: fileID})
+	}
+	switch {
+	case len(gistID) > 0 && len(fileID) > 0:
+	case len(gistID) > 0:
+		files, d.ResolvedBy = p.doubleResolveSlack(gistID)
+	default:
+		files[0].Workspace, d.GistID, d.ResolvedBy = p.doubleResolveGist(fileID)
+	}
+	for _, f := range files {
+		d.SlackFileIDs = append(d.SlackFileIDs, f.ID)
+	}
+	if len(d.GistID) == 0 || len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "Warning: The counterpart of '%s' couldn't be found. Only '%s' is deleted.\n", gistID+fileID, gistID+fileID)
+	}
+	var gistRes, slackRes []doubleRollback
+	var wg sync.WaitGroup
+	if len(d.GistID) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := (&gistDest{name: "gist", accesstoken: p.GislackCfg.Gist.GistAccesstoken.Accesstoken}).Delete(d.GistID)
+			gistRes = append(gistRes, doubleRollback{Target: "gist", ID: d.GistID, Action: "delete", OK: res.OK, Error: res.Error})
+		}()
+	}
+	if len(files) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, f := range files {
+				slackRes = append(slackRes, p.slackDeleteShared(f)...)
+			}
+		}()
+	}
+	wg.Wait()
+	d.Results = append(gistRes, slackRes...)
+	d.TotalEt = math.Trunc(time.Since(p.pstart).Seconds()*1000) / 1000
+	var failed bool
+	for _, e := range d.Results {
+		failed = failed || (!e.OK && e.Action == "delete")
+	}
+	p.doubleDeleteRecord(d, failed)
+	if p.jsonControl.Options["simpleresult"].(bool) {
+		result, _ := json.Marshal(doubleDeleteSimpleResult{
+			GistID:       d.GistID,
+			SlackFileIDs: strings.Join(d.SlackFileIDs, ","),
+			OK:           !failed,
+		})
+		fmt.Println(string(result))
+	} else {
+		var result []byte
+		if p.jsonControl.Options["jsonparser"].(bool) {
+			result, _ = json.MarshalIndent(d, "", "  ")
+		} else {
+			result, _ = json.Marshal(d)
+		}
+		fmt.Println(string(result))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// doubleDeleteRecord : Record the deletion to the ledger. When all deletions succeeded, the entry which submitted them is marked as undone.
+// Otherwise, the deleted gist and files are recorded so that undo of the entry skips them.
+func (p *iniparamsContainer) doubleDeleteRecord(d *doubleDeleteResult, failed bool) {
+	entries, _ := ledgerRead(p.CfgDir)
+	ids := append([]string{d.GistID}, d.SlackFileIDs...)
+	e := &ledgerEntry{
+		Command:   p.jsonControl.Command,
+		CreatedAt: time.Now(),
+	}
+	if m := ledgerEntryOf(entries, ids); m != nil {
+		e.Title = m.Title
+		if !failed {
+			e.Undo = m.ID
+		}
+	}
+	for _, r := range d.Results {
+		if r.Action == "delete" {
+			e.Targets = append(e.Targets, ledgerTarget{Destination: r.Target, Type: r.Target, Action: r.Action, ID: r.ID, OK: r.OK, Error: r.Error})
+		}
+	}
+	e.save(p.CfgDir)
+}
+
+// doubleResolveSlack : Resolve the Slack files which shared the gist.
+// At first, the ledger is used. When the gist is not found in the ledger, the latest file with the URL of the gist in the initial comment or the same title as the description is used.
+func (p *iniparamsContainer) doubleResolveSlack(gistID string) ([]doubleDeleteFile, string) {
+	var files []doubleDeleteFile
+	for _, t := range ledgerSlackPosts(p.CfgDir, gistID) {
+		for _, id := range doubleFiles(t.ID) {
+			files = append(files, doubleDeleteFile{ID: id, Workspace: t.Workspace})
+		}
+	}
+	if len(files) > 0 {
+		return files, "ledger"
+	}
+	g, err := gistSnapshotOf(p.GislackCfg.Gist.GistAccesstoken.Accesstoken, gistID)
+	if err != nil || len(g.ID) == 0 {
+		return nil, ""
+	}
+	q := url.Values{}
+	q.Set("token", p.slackTokenOf(""))
+	q.Set("count", "100")
+	r := &utl.RequestParams{
+		Method:      "POST",
+		APIURL:      slackurl + "files.list?" + q.Encode(),
+		Data:        nil,
+		Contenttype: "application/x-www-form-urlencoded",
+		Dtime:       10,
+	}
+	body, err := r.FetchAPI()
+	if err != nil {
+		return nil, ""
+	}
+	var fl slackFilesList
+	json.Unmarshal(body, &fl)
+	for _, f := range fl.Files {
+		if f.InitialComment != nil && strings.Contains(f.InitialComment.Comment, g.HTMLURL) {
+			return []doubleDeleteFile{{ID: f.ID}}, "url"
+		}
+	}
+	for _, f := range fl.Files {
+		if len(g.Description) > 0 && f.Title == g.Description {
+			return []doubleDeleteFile{{ID: f.ID}}, "title"
+		}
+	}
+	return nil, ""
+}
+
+// doubleResolveGist : Resolve the gist shared by the Slack file, and return the workspace, the gist ID and how it was resolved.
+// At first, the ledger is used. When the file is not found in the ledger, the URL of the gist in the initial comment or the gist with the same description as the title is used.
+func (p *iniparamsContainer) doubleResolveGist(fileID string) (string, string, string) {
+	entries, _ := ledgerRead(p.CfgDir)
+	for n := len(entries) - 1; n >= 0; n-- {
+		var ws, gistID string
+		var found bool
+		for _, t := range entries[n].Targets {
+			switch {
+			case t.Type == "gist" && t.OK:
+				gistID = t.ID
+			case t.Type == "slack" && strings.Contains(","+t.ID+",", ","+fileID+","):
+				ws, found = t.Workspace, true
+			}
+		}
+		if found && len(gistID) > 0 {
+			return ws, gistID, "ledger"
+		}
+	}
+	sf, err := slackFileInfo(p.slackTokenOf(""), fileID)
+	if err != nil {
+		return "", "", ""
+	}
+	if c := sf.File.InitialComment; c != nil {
+		if m := gistURLPattern.FindStringSubmatch(c.Comment); len(m) > 1 {
+			return "", m[1], "url"
+		}
+	}
+	if len(sf.File.Title) == 0 {
+		return "", "", ""
+	}
+	r := &utl.RequestParams{
+		Method:      "GET",
+		APIURL:      gisturl + "?per_page=100",
+		Data:        nil,
+		Contenttype: "application/x-www-form-urlencoded",
+		Accesstoken: p.GislackCfg.Gist.GistAccesstoken.Accesstoken,
+		Dtime:       10,
+	}
+	body, err := r.FetchAPI()
+	if err != nil {
+		return "", "", ""
+	}
+	var gl []gistGetList
+	json.Unmarshal(body, &gl)
+	for _, g := range gl {
+		if g.Description == sf.File.Title {
+			return "", g.ID, "title"
+		}
+	}
+	return "", "", ""
+}
+
+// slackFileInfo : Retrieve information of a file using files.info.
+func slackFileInfo(token, fileID string) (*slackFile, error) {
+	q := url.Values{}
+	q.Set("token", token)
+	q.Set("file", fileID)
+	r := &utl.RequestParams{
+		Method:      "POST",
+		APIURL:      slackurl + "files.info?" + q.Encode(),
+		Data:        nil,
+		Contenttype: "application/x-www-form-urlencoded",
+		Dtime:       10,
+	}
+	body, err := r.FetchAPI()
+	if err != nil {
+		return nil, err
+	}
+	var sf slackFile
+	json.Unmarshal(body, &sf)
+	if !sf.OK {
+		return nil, fmt.Errorf("%s", sf.Error)
+	}
+	return &sf, nil
+}
+
+// slackDeleteShared : Delete the messages sharing the file using chat.delete, and then delete the file.
+// Failures of deleting the messages are returned with the action "delete-message".
+func (p *iniparamsContainer) slackDeleteShared(f doubleDeleteFile) []doubleRollback {
+	token := p.slackTokenOf(f.Workspace)
+	var rb []doubleRollback
+	if sf, err := slackFileInfo(token, f.ID); err == nil && sf.File.Shares != nil {
+		for _, shares := range []map[string][]slackShare{sf.File.Shares.Public, sf.File.Shares.Private} {
+			for ch, e := range shares {
+				for _, sh := range e {
+					q := url.Values{}
+					q.Set("token", token)
+					q.Set("channel", ch)
+					q.Set("ts", sh.Ts)
+					r := &utl.RequestParams{
+						Method:      "POST",
+						APIURL:      slackurl + "chat.delete?" + q.Encode(),
+						Data:        nil,
+						Contenttype: "application/x-www-form-urlencoded",
+						Dtime:       10,
+					}
+					res := doubleRollback{Target: "slack", ID: ch + ":" + sh.Ts, Action: "delete-message"}
+					body, err := r.FetchAPI()
+					var se slackError
+					json.Unmarshal(body, &se)
+					switch {
+					case err != nil:
+						res.Error = err.Error()
+					case !se.OK:
+						res.Error = se.Error
+					default:
+						res.OK = true
+					}
+					rb = append(rb, res)
+				}
+			}
+		}
+	}
+	res := (&slackDest{name: "slack", token: token}).Delete(f.ID)
+	return append(rb, doubleRollback{Target: "slack", ID: f.ID, Action: "delete", OK: res.OK, Error: res.Error})
+}
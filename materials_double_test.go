@@ -0,0 +1,150 @@
+// Package main (materials_double_test.go) :
+// Tests for doubleSubmit. Gist and Slack are replaced by a fake server. Please run with "go test -race".
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeChannels : Number of Slack channels used by the tests
+const fakeChannels = 8
+
+// fakeServer : Fake server for Gist and Slack.
+// files.upload returns the file ID made from the channel. The responses are delayed in reverse order of the channels, so the later requests finish first.
+// The channel "CFAIL" returns "channel_not_found".
+func fakeServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/gists":
+			time.Sleep(time.Duration(fakeChannels) * 5 * time.Millisecond)
+			fmt.Fprint(w, `{"id":"gist1","html_url":"https://gist.github.com/gist1"}`)
+		case r.Method == "POST" && r.URL.Path == "/api/files.upload":
+			ch := r.URL.Query().Get("channels")
+			f, h, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			data, _ := ioutil.ReadAll(f)
+			f.Close()
+			if ch == "CFAIL" {
+				fmt.Fprint(w, `{"ok":false,"error":"channel_not_found"}`)
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimPrefix(ch, "C"))
+			time.Sleep(time.Duration(fakeChannels-n) * 5 * time.Millisecond)
+			res, _ := json.Marshal(map[string]interface{}{
+				"ok": true,
+				"file": map[string]interface{}{
+					"id":       "F" + ch + "_" + h.Filename + "_" + string(data),
+					"name":     h.Filename,
+					"channels": []string{ch},
+				},
+			})
+			w.Write(res)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// useFakeServer : Replace the endpoints of Gist and Slack with the fake server until the test finishes.
+func useFakeServer(t *testing.T) {
+	srv := fakeServer(t)
+	g, s := gisturl, slackurl
+	gisturl, slackurl = srv.URL+"/gists", srv.URL+"/api/"
+	t.Cleanup(func() {
+		gisturl, slackurl = g, s
+		srv.Close()
+	})
+}
+
+func TestDoubleSubmittingOrder(t *testing.T) {
+	useFakeServer(t)
+	p := &destPayload{
+		Title: "sample",
+		Files: []destFile{{Name: "sample.txt", Data: []byte("content")}},
+	}
+	d := &doubleParam{}
+	d.Requests = append(d.Requests, doubleRequest{
+		Destination: "gist",
+		Dest:        &gistDest{name: "gist", accesstoken: "gisttoken"},
+		Payload:     p,
+	})
+	var channels []string
+	for n := 0; n < fakeChannels; n++ {
+		channels = append(channels, "C"+strconv.Itoa(n))
+	}
+	channels = append(channels, "CFAIL")
+	dest := &slackDestination{
+		Token:      "slacktoken",
+		Channels:   channels,
+		ChannelIDs: channels,
+	}
+	d.Requests = append(d.Requests, dest.doubleRequests("sample.txt", p)...)
+
+	res := d.doubleSubmitting()
+	if len(res) != len(d.Requests) {
+		t.Fatalf("got %d responses, want %d", len(res), len(d.Requests))
+	}
+	var g gistGetList
+	json.Unmarshal([]byte(res[0].Body), &g)
+	if res[0].Destination != "gist" || res[0].StatusCode != 200 || g.ID != "gist1" || len(res[0].Error) > 0 {
+		t.Errorf("response of gist = %+v", res[0])
+	}
+	for n, e := range res[1:] {
+		req := d.Requests[n+1]
+		if e.Destination != "slack" || e.channel != req.Channel || e.File != "sample.txt" || e.StatusCode != 200 {
+			t.Errorf("response %d is %s:%s (%d), want slack:%s (200)", n+1, e.Destination, e.channel, e.StatusCode, req.Channel)
+			continue
+		}
+		var fl slackFileList
+		json.Unmarshal([]byte(e.Body), &fl)
+		if req.Channel == "CFAIL" {
+			if fl.OK || fl.Error != "channel_not_found" || len(e.Error) == 0 {
+				t.Errorf("response of CFAIL = %+v", e)
+			}
+			continue
+		}
+		if want := "F" + req.Channel + "_sample.txt_content"; !fl.OK || fl.File.ID != want {
+			t.Errorf("file ID of %s = %q, want %q", req.Channel, fl.File.ID, want)
+		}
+	}
+}
+
+func TestDoubleSubmittingWorkspaces(t *testing.T) {
+	useFakeServer(t)
+	p := &destPayload{
+		Title: "sample",
+		Files: []destFile{{Name: "sample.txt", Data: []byte("content")}},
+	}
+	d := &doubleParam{}
+	for n := 0; n < fakeChannels; n++ {
+		ch := "C" + strconv.Itoa(n)
+		dest := &slackDestination{
+			Workspace:  "ws" + strconv.Itoa(n),
+			Token:      "slacktoken",
+			Channels:   []string{ch},
+			ChannelIDs: []string{ch},
+		}
+		d.Requests = append(d.Requests, dest.doubleRequests("", p)...)
+	}
+	res := d.doubleSubmitting()
+	for n, e := range res {
+		var fl slackFileList
+		json.Unmarshal([]byte(e.Body), &fl)
+		ws := "ws" + strconv.Itoa(n)
+		if e.Destination != "slack:"+ws || e.workspace != ws || !strings.HasPrefix(fl.File.ID, "FC"+strconv.Itoa(n)+"_") {
+			t.Errorf("response %d = %s %s %s, want slack:%s", n, e.Destination, e.workspace, fl.File.ID, ws)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Package main (materials_double_update.go) :
+// Materials for propagating an update of a gist to the Slack post which shared the gist.
+// The Slack post is found from the ledger of submissions.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// slackUpdateMode : Return "replace" or "thread" when a gist is updated with "slack-update".
+// For "new" and new submissions, "" is returned, and the files are submitted to Slack as new files.
+func (p *iniparamsContainer) slackUpdateMode() string {
+	mode, _ := p.jsonControl.Options["slack-update"].(string)
+	switch mode {
+	case "", "new":
+		return ""
+	case "replace", "thread":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: '%s' is not a supported mode. Please use 'replace', 'thread' or 'new'.\n", mode)
+		os.Exit(1)
+	}
+	if len(p.gistUpdateID()) == 0 {
+		return ""
+	}
+	return mode
+}
+
+// useSlackUpdate : Check whether the Slack post is updated by "slack-update". In this case, "channel" is not required.
+func (i *iniparamsContainer) useSlackUpdate() bool {
+	mode, _ := i.jsonControl.Options["slack-update"].(string)
+	return mode == "replace" || mode == "thread"
+}
+
+// ledgerSlackPosts : Retrieve the Slack posts which shared the gist from the ledger.
+// The posts of the latest entry, which is not undone and has the gist and Slack, are returned.
+// The files deleted by later entries like "replace" are excluded.
+func ledgerSlackPosts(cfgdir, gistID string) []ledgerTarget {
+	entries, err := ledgerRead(cfgdir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s couldn't be read. [ %v ]\n", ledgerFile, err)
+		return nil
+	}
+	undone := map[string]bool{}
+	for _, e := range entries {
+		if len(e.Undo) > 0 {
+			undone[e.Undo] = true
+		}
+	}
+	deleted := ledgerDeleted(entries)
+	for n := len(entries) - 1; n >= 0; n-- {
+		e := entries[n]
+		if len(e.Undo) > 0 || undone[e.ID] {
+			continue
+		}
+		var gist bool
+		var posts []ledgerTarget
+		for _, t := range e.Targets {
+			switch {
+			case t.Type == "gist" && t.ID == gistID && t.OK:
+				gist = true
+			case t.Type == "slack" && t.OK && t.Action != "delete" && len(deleted[t.ID]) == 0 && len(t.Channel) > 0 && len(t.Ts) > 0:
+				posts = append(posts, t)
+			}
+		}
+		if gist && len(posts) > 0 {
+			return posts
+		}
+	}
+	return nil
+}
+
+// doubleSubmitUpdate : Update the gist at first, and then submit the files to the Slack posts which shared the gist.
+// "thread" posts the files as replies with a diff summary of the update. "replace" posts the files to the same channels, and the files of the original posts are deleted.
+// When the posts are not found in the ledger, the files are submitted to "channel" as new files.
+func (p *iniparamsContainer) doubleSubmitUpdate(mode string, g *doubleRequest, s *slackContainer, snapshot *gistGetList) {
+	id := p.gistUpdateID()
+	posts := ledgerSlackPosts(p.CfgDir, id)
+	if len(posts) == 0 {
+		if ch, _ := p.jsonControl.Options["channel"].(string); len(ch) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: The Slack post which shared gist ID '%s' was not found in %s. Please use '-ch'.\n", id, ledgerFile)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: The Slack post which shared gist ID '%s' was not found in %s. The files are submitted as new files.\n", id, ledgerFile)
+		res := p.doubleSubmitInit(g, s.slackDoubleRequests()).doubleSubmitting()
+		p.doubleSubmittingDisp(res, snapshot)
+		return
+	}
+	var dests []*slackDestination
+	for _, t := range posts {
+		channels := strings.Split(t.Channel, ",")
+		if mode == "replace" {
+			dests = append(dests, &slackDestination{
+				Workspace:  t.Workspace,
+				Token:      p.slackTokenOf(t.Workspace),
+				Channels:   channels,
+				ChannelIDs: channels,
+			})
+			continue
+		}
+		ts := strings.Split(t.Ts, ",")
+		for n, ch := range channels {
+			if n < len(ts) {
+				dests = append(dests, &slackDestination{
+					Workspace:  t.Workspace,
+					Token:      p.slackTokenOf(t.Workspace),
+					Channels:   []string{ch},
+					ChannelIDs: []string{ch},
+					ThreadTs:   ts[n],
+				})
+			}
+		}
+	}
+	s.slackParams.Destinations = dests
+	prev := snapshot
+	if mode == "thread" && prev == nil {
+		prev = p.gistSnapshot()
+	}
+	gr := doubleFetch(*g)
+	var gg gistGetList
+	json.Unmarshal([]byte(gr.Body), &gg)
+	if len(gr.Error) > 0 || gg.ID == "" {
+		fmt.Fprintf(os.Stderr, "Error: The gist couldn't be updated. Nothing was submitted to Slack. %s, %s\n", gr.Error, gr.Body)
+		os.Exit(1)
+	}
+	comment := p.jsonControl.Options["initialcomment"].(string)
+	if link, _ := p.jsonControl.Options["link"].(bool); link {
+		tmpl, _ := p.jsonControl.Options["template"].(string)
+		if len(tmpl) == 0 {
+			tmpl = doubleLinkTemplate
+		}
+		comment = gistLinkComment(tmpl, comment, gg)
+	}
+	if mode == "thread" {
+		comment = strings.TrimSpace(gistDiffSummary(prev, gg) + "\n" + comment)
+	}
+	p.jsonControl.Options["initialcomment"] = comment
+	res := p.doubleSubmitInit(nil, s.slackDoubleRequests()).doubleSubmitting()
+	p.doubleSubmittingDisp(append([]doubleResponse{gr}, res...), snapshot)
+}
+
+// slackReplacePosts : Delete the files of the Slack posts replaced by "replace".
+// The files are deleted only for the workspaces that the new files were submitted to.
+func (p *iniparamsContainer) slackReplacePosts(d *doubleResults) []doubleRollback {
+	var rb []doubleRollback
+	for _, t := range ledgerSlackPosts(p.CfgDir, p.gistUpdateID()) {
+		var submitted bool
+		for _, e := range d.Slacks {
+			submitted = submitted || (e.OK && e.Workspace == t.Workspace)
+		}
+		if !submitted {
+			continue
+		}
+		res := (&slackDest{name: "slack", token: p.slackTokenOf(t.Workspace)}).Delete(t.ID)
+		rb = append(rb, doubleRollback{
+			Target: "slack",
+			ID:     t.ID,
+			Action: "delete",
+			OK:     res.OK,
+			Error:  res.Error,
+		})
+	}
+	return rb
+}
+
+// gistDiffSummary : Create a summary of the differences between the files of prev and g.
+// The numbers of added and removed lines are counted for each file.
+func gistDiffSummary(prev *gistGetList, g gistGetList) string {
+	var revision string
+	if len(g.History) > 0 {
+		revision = g.History[0].Version
+		if len(revision) > 7 {
+			revision = revision[:7]
+		}
+	}
+	names := map[string]bool{}
+	for name := range g.Files {
+		names[name] = true
+	}
+	if prev != nil {
+		for name := range prev.Files {
+			names[name] = true
+		}
+	}
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	lines := []string{fmt.Sprintf("Gist was updated to revision %s.", revision)}
+	for _, name := range sorted {
+		before, hasBefore := gistFileContent(prev, name)
+		after, hasAfter := gistFileContent(&g, name)
+		switch {
+		case !hasAfter:
+			lines = append(lines, fmt.Sprintf("- `%s` : deleted", name))
+		case !hasBefore:
+			lines = append(lines, fmt.Sprintf("- `%s` : added (+%d)", name, len(strings.Split(after, "\n"))))
+		case before != after:
+			add, del := lineDiff(before, after)
+			lines = append(lines, fmt.Sprintf("- `%s` : +%d -%d", name, add, del))
+		}
+	}
+	if len(lines) == 1 {
+		lines = append(lines, "No changes of files.")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// gistFileContent : Retrieve the content of the file from the gist.
+func gistFileContent(g *gistGetList, name string) (string, bool) {
+	if g == nil {
+		return "", false
+	}
+	e, ok := g.Files[name]
+	if !ok || e == nil {
+		return "", false
+	}
+	f, _ := e.(map[string]interface{})
+	content, _ := f["content"].(string)
+	return content, true
+}
+
+// lineDiff : Count added and removed lines. After removing the common lines at the head and the tail, the rest lines are compared as multisets.
+func lineDiff(before, after string) (int, int) {
+	a := strings.Split(before, "\n")
+	b := strings.Split(after, "\n")
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	count := map[string]int{}
+	for _, e := range a {
+		count[e]++
+	}
+	var add int
+	for _, e := range b {
+		if count[e] > 0 {
+			count[e]--
+			continue
+		}
+		add++
+	}
+	var del int
+	for _, c := range count {
+		del += c
+	}
+	return add, del
+}
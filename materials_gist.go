@@ -5,18 +5,18 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"text/tabwriter"
 	"time"
 
-	pb "gopkg.in/cheggaaa/pb.v1"
-
 	"github.com/tanaikech/gislack/utl"
 )
 
@@ -81,6 +81,7 @@ func (i *iniparamsContainer) initGistContainer() *gistContainer {
 		&jsonControl{},
 	}
 	g.initVal.workdir = i.authParams.WorkDir
+	g.initVal.cfgdir = i.authParams.CfgDir
 	g.jsonControl = i.jsonControl
 	if len(g.Accesstoken) == 0 {
 		fmt.Fprintf(os.Stderr, "Error: Access token of GitHub is NOT found. Please retrieve Client ID and Client Secret from GitHub, and run 'gislack auth -gi clientid -gs clientsecret'.\n")
@@ -403,6 +404,7 @@ func (g *gistContainer) gistDel() {
 }
 
 // gistDeleteAll : Delete all gists. When you use this command, please be careful.
+// When SIGINT is received, the request in progress is canceled and reported as unknown.
 func (g *gistContainer) gistDeleteAll() {
 	r := &utl.RequestParams{
 		Method:      "GET",
@@ -425,9 +427,15 @@ func (g *gistContainer) gistDeleteAll() {
 			log.Fatalf("Error: %v.\n", err)
 		}
 		if input == "y" {
-			bar := pb.StartNew(len(g.GistGetList))
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			var done []string
+			var canceled string
+			bar := newProgressBar(len(g.GistGetList))
 			for _, e := range g.GistGetList {
-				bar.Increment()
+				if ctx.Err() != nil {
+					break
+				}
 				r := &utl.RequestParams{
 					Method:      "DELETE",
 					APIURL:      gisturl + "/" + e.ID,
@@ -435,12 +443,25 @@ func (g *gistContainer) gistDeleteAll() {
 					Contenttype: "application/x-www-form-urlencoded",
 					Accesstoken: g.Accesstoken,
 					Dtime:       10,
+					Context:     ctx,
 				}
 				_, err := r.FetchAPI()
+				if err != nil && ctx.Err() != nil {
+					canceled = e.ID
+					break
+				}
 				if err != nil {
+					bar.Finish()
 					fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+					dispBulkResult("gists", done, len(g.GistGetList), false, "")
 					os.Exit(1)
 				}
+				done = append(done, e.ID)
+				bar.Increment()
+			}
+			if ctx.Err() != nil {
+				bar.Finish()
+				dispBulkResult("gists", done, len(g.GistGetList), true, canceled)
 			}
 			bar.FinishPrint("Done.")
 		} else {
@@ -450,3 +471,98 @@ func (g *gistContainer) gistDeleteAll() {
 		fmt.Println("No gists.")
 	}
 }
+
+// gistDest : Gist as a destination
+type gistDest struct {
+	name        string
+	accesstoken string
+	public      bool
+}
+
+// newGistDest : Create a destination of Gist. "token" of the destination is used instead of the access token of gislack.cfg.
+func newGistDest(i *iniparamsContainer, name string, c destinationCfg) (Destination, error) {
+	d := &gistDest{
+		name:        name,
+		accesstoken: i.GislackCfg.Gist.GistAccesstoken.Accesstoken,
+		public:      c.Public,
+	}
+	if len(c.Token) > 0 {
+		d.accesstoken = c.Token
+	}
+	if len(d.accesstoken) == 0 {
+		return nil, fmt.Errorf("Access token of GitHub is NOT found. Please run 'gislack auth -gi clientid -gs clientsecret'")
+	}
+	return d, nil
+}
+
+// Name : Name of the destination
+func (d *gistDest) Name() string {
+	return d.name
+}
+
+// request : Request to Gist, and set ID and URL of the gist to the result.
+func (d *gistDest) request(action, method, id string, payload *gistPayload) destResult {
+	apiurl := gisturl
+	if len(id) > 0 {
+		apiurl += "/" + id
+	}
+	r := &utl.RequestParams{
+		Method:      method,
+		APIURL:      apiurl,
+		Data:        nil,
+		Contenttype: "application/x-www-form-urlencoded",
+		Accesstoken: d.accesstoken,
+		Dtime:       10,
+	}
+	if payload != nil {
+		b, _ := json.Marshal(payload)
+		r.Data = bytes.NewBuffer(b)
+	}
+	res, body := destFetch(d.name, "gist", action, r)
+	res.ID = id
+	if body != nil {
+		var g gistGetList
+		json.Unmarshal(body, &g)
+		if len(g.ID) > 0 {
+			res.ID = g.ID
+			res.URL = g.HTMLURL
+		}
+	}
+	return res
+}
+
+// gistDestPayload : Convert a payload of destinations to a payload of Gist.
+func (d *gistDest) gistDestPayload(p *destPayload) *gistPayload {
+	g := &gistPayload{
+		Description: p.Title,
+		Public:      p.Public || d.public,
+		Files:       map[string]interface{}{},
+	}
+	for _, f := range p.Files {
+		g.Files[f.Name] = map[string]interface{}{"content": string(f.Data)}
+	}
+	for _, name := range p.Remove {
+		g.Files[name] = nil
+	}
+	return g
+}
+
+// Submit : Submit files as a new gist.
+func (d *gistDest) Submit(p *destPayload) destResult {
+	return d.request("submit", "POST", "", d.gistDestPayload(p))
+}
+
+// Update : Update a gist. Files are added or overwritten.
+func (d *gistDest) Update(id string, p *destPayload) destResult {
+	return d.request("update", "PATCH", id, d.gistDestPayload(p))
+}
+
+// Delete : Delete a gist.
+func (d *gistDest) Delete(id string) destResult {
+	return d.request("delete", "DELETE", id, nil)
+}
+
+// Get : Retrieve a gist.
+func (d *gistDest) Get(id string) destResult {
+	return d.request("get", "GET", id, nil)
+}
@@ -0,0 +1,407 @@
+// Package main (materials_gitlab.go) :
+// Materials for snippets of GitLab.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tanaikech/gislack/utl"
+)
+
+// gitlabDefaultURL : Default base URL of GitLab
+const gitlabDefaultURL = "https://gitlab.com"
+
+// gitlabParams : Parameters for GitLab
+type gitlabParams struct {
+	Dest     *gitlabDest
+	Snippets []gitlabSnippet
+}
+
+// gitlabContainer : Container included parameters
+type gitlabContainer struct {
+	*initVal
+	*gitlabParams
+	*jsonControl
+}
+
+// gitlabSnippet : Snippet of GitLab
+type gitlabSnippet struct {
+	ID          int                 `json:"id"`
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	Visibility  string              `json:"visibility"`
+	WebURL      string              `json:"web_url"`
+	ProjectID   int                 `json:"project_id,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+	Files       []gitlabSnippetFile `json:"files,omitempty"`
+	Author      struct {
+		Username string `json:"username,omitempty"`
+	} `json:"author,omitempty"`
+}
+
+// gitlabSnippetFile : File of a snippet
+type gitlabSnippetFile struct {
+	Path    string `json:"path"`
+	RawURL  string `json:"raw_url"`
+	SavedTo string `json:"saved_to,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// gitlabDest : Snippets of GitLab as a destination. When project is used, project snippets are used.
+type gitlabDest struct {
+	name        string
+	baseURL     string
+	accesstoken string
+	project     string
+	visibility  string
+}
+
+// newGitLabDest : Create a destination of GitLab. "url", "token", "project" and "visibility" of the destination are used.
+func newGitLabDest(i *iniparamsContainer, name string, c destinationCfg) (Destination, error) {
+	d := &gitlabDest{
+		name:        name,
+		baseURL:     i.GislackCfg.GitLab.URL,
+		accesstoken: i.GislackCfg.GitLab.Accesstoken,
+		project:     c.Project,
+		visibility:  c.Visibility,
+	}
+	if len(c.URL) > 0 {
+		d.baseURL = c.URL
+	}
+	if len(d.baseURL) == 0 {
+		d.baseURL = gitlabDefaultURL
+	}
+	d.baseURL = strings.TrimRight(d.baseURL, "/")
+	if len(c.Token) > 0 {
+		d.accesstoken = c.Token
+	}
+	if len(d.accesstoken) == 0 {
+		return nil, fmt.Errorf("Access token of GitLab is NOT found. Please run 'gislack auth --gitlabtoken token'")
+	}
+	if len(d.visibility) > 0 && d.visibility != "private" && d.visibility != "internal" && d.visibility != "public" {
+		return nil, fmt.Errorf("Visibility '%s' is not supported. Please use 'private', 'internal' or 'public'", d.visibility)
+	}
+	return d, nil
+}
+
+// Name : Name of the destination
+func (d *gitlabDest) Name() string {
+	return d.name
+}
+
+// snippetsURL : URL of snippets. When id is empty, the URL of the list is returned.
+func (d *gitlabDest) snippetsURL(id string) string {
+	u := d.baseURL + "/api/v4"
+	if len(d.project) > 0 {
+		u += "/projects/" + url.PathEscape(d.project)
+	}
+	u += "/snippets"
+	if len(id) > 0 {
+		u += "/" + id
+	}
+	return u
+}
+
+// request : Request to GitLab, and set ID and URL of the snippet to the result.
+func (d *gitlabDest) request(action, method, id string, payload interface{}) destResult {
+	r := &utl.RequestParams{
+		Method:      method,
+		APIURL:      d.snippetsURL(id),
+		Data:        nil,
+		Contenttype: "application/json",
+		Accesstoken: d.accesstoken,
+		Dtime:       10,
+	}
+	if payload != nil {
+		b, _ := json.Marshal(payload)
+		r.Data = bytes.NewBuffer(b)
+	}
+	res, body := destFetch(d.name, "gitlab", action, r)
+	res.ID = id
+	if body != nil {
+		var sn gitlabSnippet
+		json.Unmarshal(body, &sn)
+		if sn.ID > 0 {
+			res.ID = strconv.Itoa(sn.ID)
+			res.URL = sn.WebURL
+		}
+	}
+	return res
+}
+
+// Submit : Submit files as a new snippet. When the title is empty, the name of the first file is used.
+func (d *gitlabDest) Submit(p *destPayload) destResult {
+	title := p.Title
+	if len(title) == 0 && len(p.Files) > 0 {
+		title = p.Files[0].Name
+	}
+	visibility := d.visibility
+	if len(visibility) == 0 {
+		visibility = "private"
+	}
+	if p.Public {
+		visibility = "public"
+	}
+	var files []map[string]string
+	for _, f := range p.Files {
+		files = append(files, map[string]string{
+			"file_path": f.Name,
+			"content":   string(f.Data),
+		})
+	}
+	return d.request("submit", "POST", "", map[string]interface{}{
+		"title":       title,
+		"description": p.Comment,
+		"visibility":  visibility,
+		"files":       files,
+	})
+}
+
+// Update : Update a snippet. Existing files are overwritten and other files are added. The visibility is kept when "visibility" is not used.
+func (d *gitlabDest) Update(id string, p *destPayload) destResult {
+	cur := d.Get(id)
+	if !cur.OK {
+		cur.Action = "update"
+		return cur
+	}
+	var sn gitlabSnippet
+	json.Unmarshal(cur.Response, &sn)
+	exists := map[string]bool{}
+	for _, f := range sn.Files {
+		exists[f.Path] = true
+	}
+	var files []map[string]string
+	for _, f := range p.Files {
+		action := "create"
+		if exists[f.Name] {
+			action = "update"
+		}
+		files = append(files, map[string]string{
+			"action":    action,
+			"file_path": f.Name,
+			"content":   string(f.Data),
+		})
+	}
+	payload := map[string]interface{}{
+		"files": files,
+	}
+	if len(p.Title) > 0 {
+		payload["title"] = p.Title
+	}
+	if len(p.Comment) > 0 {
+		payload["description"] = p.Comment
+	}
+	switch {
+	case len(d.visibility) > 0:
+		payload["visibility"] = d.visibility
+	case p.Public:
+		payload["visibility"] = "public"
+	}
+	return d.request("update", "PUT", id, payload)
+}
+
+// Delete : Delete a snippet.
+func (d *gitlabDest) Delete(id string) destResult {
+	return d.request("delete", "DELETE", id, nil)
+}
+
+// Get : Retrieve a snippet.
+func (d *gitlabDest) Get(id string) destResult {
+	return d.request("get", "GET", id, nil)
+}
+
+// list : Retrieve snippets.
+func (d *gitlabDest) list() ([]gitlabSnippet, error) {
+	var snippets []gitlabSnippet
+	for page := 1; ; page++ {
+		r := &utl.RequestParams{
+			Method:      "GET",
+			APIURL:      d.snippetsURL("") + "?per_page=100&page=" + strconv.Itoa(page),
+			Data:        nil,
+			Contenttype: "application/json",
+			Accesstoken: d.accesstoken,
+			Dtime:       10,
+		}
+		body, err := r.FetchAPI()
+		if err != nil {
+			return nil, fmt.Errorf("%v, %s", err, string(body))
+		}
+		var ar []gitlabSnippet
+		json.Unmarshal(body, &ar)
+		snippets = append(snippets, ar...)
+		if len(ar) < 100 {
+			break
+		}
+	}
+	return snippets, nil
+}
+
+// initGitLabContainer : Initialize parameters for GitLab. "project" and "visibility" are used instead of gislack.cfg.
+func (i *iniparamsContainer) initGitLabContainer() *gitlabContainer {
+	g := &gitlabContainer{
+		&initVal{
+			pstart:  i.authParams.pstart,
+			workdir: i.authParams.WorkDir,
+			cfgdir:  i.authParams.CfgDir,
+		},
+		&gitlabParams{},
+		i.jsonControl,
+	}
+	d, err := newGitLabDest(i, "gitlab", destinationCfg{
+		Project:    i.jsonControl.Options["project"].(string),
+		Visibility: i.jsonControl.Options["visibility"].(string),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v.\n", err)
+		os.Exit(1)
+	}
+	g.Dest = d.(*gitlabDest)
+	g.jsonControl.Options["file"] = g.jsonControl.Options["files"]
+	g.jsonControl.Options["filename"] = g.jsonControl.Options["filenames"]
+	g.jsonControl.Options["initialcomment"] = g.jsonControl.Options["description"]
+	g.jsonControl.Options["public"] = false
+	return g
+}
+
+// gitlabResult : Stop when the request failed, and add the snippet to the container.
+func (g *gitlabContainer) gitlabResult(r destResult) *gitlabContainer {
+	if !r.OK {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", r.Error)
+		os.Exit(1)
+	}
+	var sn gitlabSnippet
+	json.Unmarshal(r.Response, &sn)
+	sn.CreatedAt = sn.CreatedAt.In(time.Local)
+	sn.UpdatedAt = sn.UpdatedAt.In(time.Local)
+	g.Snippets = append(g.Snippets, sn)
+	return g
+}
+
+// gitlabSubmit : Submit files as a new snippet
+func (g *gitlabContainer) gitlabSubmit() *gitlabContainer {
+	r := g.Dest.Submit(g.jsonControl.destPayload(g.workdir))
+	g.record(r)
+	return g.gitlabResult(r)
+}
+
+// gitlabUpdate : Update a snippet
+func (g *gitlabContainer) gitlabUpdate() *gitlabContainer {
+	r := g.Dest.Update(g.jsonControl.Options["update"].(string), g.jsonControl.destPayload(g.workdir))
+	g.record(r)
+	return g.gitlabResult(r)
+}
+
+// gitlabGet : Retrieve a snippet, and save the files to the working directory.
+func (g *gitlabContainer) gitlabGet() *gitlabContainer {
+	g.gitlabResult(g.Dest.Get(g.jsonControl.Options["get"].(string)))
+	sn := &g.Snippets[0]
+	for n, f := range sn.Files {
+		outfile := filepath.Join(g.workdir, filepath.Base(f.Path))
+		if _, err := os.Stat(outfile); err == nil {
+			sn.Files[n].Error = fmt.Sprintf("%s already exists. Content was not saved to a file.", outfile)
+			continue
+		}
+		r := &utl.RequestParams{
+			Method:      "GET",
+			APIURL:      f.RawURL,
+			Data:        nil,
+			Accesstoken: g.Dest.accesstoken,
+			Dtime:       10,
+		}
+		body, err := r.FetchAPI()
+		if err != nil {
+			sn.Files[n].Error = err.Error()
+			continue
+		}
+		if err := ioutil.WriteFile(outfile, body, 0644); err != nil {
+			sn.Files[n].Error = err.Error()
+			continue
+		}
+		sn.Files[n].SavedTo = outfile
+	}
+	return g
+}
+
+// gitlabDelete : Delete a snippet
+func (g *gitlabContainer) gitlabDelete() {
+	r := g.Dest.Delete(g.jsonControl.Options["delete"].(string))
+	if !r.OK {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", r.Error)
+		os.Exit(1)
+	}
+	fmt.Println("Done.")
+}
+
+// gitlabList : Retrieve snippet list
+func (g *gitlabContainer) gitlabList() {
+	snippets, err := g.Dest.list()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(snippets) == 0 {
+		fmt.Println("No snippets.")
+		return
+	}
+	for n, e := range snippets {
+		snippets[n].CreatedAt = e.CreatedAt.In(time.Local)
+		snippets[n].UpdatedAt = e.UpdatedAt.In(time.Local)
+	}
+	if g.jsonControl.Options["listasjson"].(bool) {
+		listjson, _ := json.MarshalIndent(snippets, "", "  ")
+		fmt.Println(string(listjson))
+		return
+	}
+	buffer := &bytes.Buffer{}
+	w := new(tabwriter.Writer)
+	w.Init(buffer, 0, 4, 1, ' ', 0)
+	for _, e := range snippets {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n",
+			e.Title,
+			e.UpdatedAt.Format("20060102_15:04:05"),
+			e.Visibility,
+			e.ID,
+		)
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "# Title", "# Updated time", "# Visibility", "# id")
+	w.Flush()
+	s := bufio.NewScanner(buffer)
+	var ar []string
+	for s.Scan() {
+		ar = append(ar, s.Text())
+	}
+	for i := len(ar) - 1; i >= 0; i-- {
+		fmt.Println(ar[i])
+	}
+}
+
+// disp : Display results for GitLab
+func (g *gitlabContainer) disp() {
+	if g.jsonControl.Options["simpleresult"].(bool) {
+		result, _ := json.Marshal(struct {
+			CreatedAt string `json:"gitlab_created_at"`
+			ID        string `json:"gitlab_id"`
+		}{g.Snippets[0].CreatedAt.Format("20060102_15:04:05"), strconv.Itoa(g.Snippets[0].ID)})
+		fmt.Println(string(result))
+		return
+	}
+	var result []byte
+	if g.jsonControl.Options["jsonparser"].(bool) {
+		result, _ = json.MarshalIndent(g.Snippets[0], "", "  ")
+	} else {
+		result, _ = json.Marshal(g.Snippets[0])
+	}
+	fmt.Println(string(result))
+}
@@ -0,0 +1,561 @@
+// Package main (materials_ledger.go) :
+// Materials for the ledger of submissions. Every submission is appended to a JSON Lines file in the directory of gislack.cfg.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ledgerFile : File name of the ledger
+const ledgerFile = "gislack_ledger.jsonl"
+
+// ledgerEntry : An entry of the ledger. When Undo is used, this entry is the undo of the entry of Undo.
+type ledgerEntry struct {
+	ID        string           `json:"id"`
+	Command   string           `json:"command"`
+	Title     string           `json:"title,omitempty"`
+	Files     []ledgerFileHash `json:"files,omitempty"`
+	Targets   []ledgerTarget   `json:"targets,omitempty"`
+	Undo      string           `json:"undo,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// ledgerFileHash : A submitted file and the hash of the content
+type ledgerFileHash struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// ledgerTarget : A submission to a destination. For Slack, Channel and Ts are the channel IDs and the timestamps of the shares separated by ",".
+// When a file was shared as a reply, Ts is the timestamp of the parent message.
+// Webhook is the name of the webhook in gislack.cfg. URLs of webhooks are credentials, so they are recorded as "webhook-url" without the URL.
+type ledgerTarget struct {
+	Destination string `json:"destination"`
+	Type        string `json:"type"`
+	Action      string `json:"action"`
+	ID          string `json:"id,omitempty"`
+	Revision    string `json:"revision,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Workspace   string `json:"workspace,omitempty"`
+	Channel     string `json:"channel,omitempty"`
+	Team        string `json:"team,omitempty"`
+	Project     string `json:"project,omitempty"`
+	Webhook     string `json:"webhook,omitempty"`
+	Ts          string `json:"ts,omitempty"`
+	OK          bool   `json:"ok"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ledgerNewEntry : Create an entry with the hashes of files separated by ",".
+func ledgerNewEntry(j *jsonControl, workdir, files string) *ledgerEntry {
+	title, _ := j.Options["title"].(string)
+	e := &ledgerEntry{
+		Command:   j.Command,
+		Title:     title,
+		CreatedAt: time.Now(),
+	}
+	for _, f := range doubleFiles(files) {
+		fpath := f
+		if filepath.Dir(f) == "." {
+			fpath = filepath.Join(workdir, f)
+		}
+		h := ledgerFileHash{Path: fpath}
+		if data, err := ioutil.ReadFile(fpath); err == nil {
+			sum := sha256.Sum256(data)
+			h.SHA256 = hex.EncodeToString(sum[:])
+		}
+		e.Files = append(e.Files, h)
+	}
+	return e
+}
+
+// save : Append the entry to the ledger. Entries without succeeded targets are not recorded because there is nothing to undo.
+// When the ledger cannot be written, only a warning is displayed.
+func (e *ledgerEntry) save(cfgdir string) {
+	var ok bool
+	for _, t := range e.Targets {
+		ok = ok || t.OK
+	}
+	if !ok {
+		return
+	}
+	e.ID = e.CreatedAt.Format("20060102-150405.000")
+	line, _ := json.Marshal(e)
+	f, err := os.OpenFile(filepath.Join(cfgdir, ledgerFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err == nil {
+		_, err = f.Write(append(line, '\n'))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: The submission couldn't be recorded to %s. [ %v ]\n", ledgerFile, err)
+	}
+}
+
+// ledgerRead : Read all entries of the ledger. Broken lines are skipped.
+func ledgerRead(cfgdir string) ([]ledgerEntry, error) {
+	f, err := os.Open(filepath.Join(cfgdir, ledgerFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []ledgerEntry
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for s.Scan() {
+		var e ledgerEntry
+		if json.Unmarshal(s.Bytes(), &e) == nil && len(e.ID) > 0 {
+			entries = append(entries, e)
+		}
+	}
+	return entries, s.Err()
+}
+
+// ledgerGistTarget : Create a target from a gist.
+func ledgerGistTarget(action string, g gistGetList) ledgerTarget {
+	t := ledgerTarget{
+		Destination: "gist",
+		Type:        "gist",
+		Action:      action,
+		ID:          g.ID,
+		URL:         g.HTMLURL,
+		OK:          len(g.ID) > 0,
+	}
+	if len(g.History) > 0 {
+		t.Revision = g.History[0].Version
+	}
+	if !t.OK {
+		t.Error = "The file couldn't submit to Gist."
+	}
+	return t
+}
+
+// ledgerSlackTarget : Create a target from a file submitted to Slack.
+func ledgerSlackTarget(action string, fl slackFileList) ledgerTarget {
+	t := ledgerTarget{
+		Destination: "slack",
+		Type:        "slack",
+		Action:      action,
+		ID:          fl.File.ID,
+		Workspace:   fl.Workspace,
+		OK:          fl.OK,
+		Error:       fl.Error,
+	}
+	var channels, ts []string
+	if sh := fl.File.Shares; sh != nil {
+		for _, shares := range []map[string][]slackShare{sh.Public, sh.Private} {
+			for ch, e := range shares {
+				if len(e) > 0 {
+					channels = append(channels, ch)
+					if len(e[0].ThreadTs) > 0 {
+						ts = append(ts, e[0].ThreadTs)
+					} else {
+						ts = append(ts, e[0].Ts)
+					}
+				}
+			}
+		}
+	}
+	if len(channels) == 0 {
+		channels = fl.File.Channels
+	}
+	t.Channel = strings.Join(channels, ",")
+	t.Ts = strings.Join(ts, ",")
+	return t
+}
+
+// ledgerDestTarget : Create a target from a result of a destination. c is used for deleting the submission by undo.
+func ledgerDestTarget(r destResult, c destinationCfg) ledgerTarget {
+	return ledgerTarget{
+		Destination: r.Destination,
+		Type:        r.Type,
+		Action:      r.Action,
+		ID:          r.ID,
+		URL:         r.URL,
+		Workspace:   c.Workspace,
+		Channel:     c.Channel,
+		Team:        c.Team,
+		Project:     c.Project,
+		Webhook:     ledgerWebhookName(c.Webhook),
+		OK:          r.OK,
+		Error:       r.Error,
+	}
+}
+
+// ledgerWebhookName : Name of the webhook recorded to the ledger. A URL is replaced with "webhook-url".
+func ledgerWebhookName(webhook string) string {
+	if strings.Contains(webhook, "://") {
+		return "webhook-url"
+	}
+	return webhook
+}
+
+// record : Record the submission of Gist. The last gist of the list is the submitted gist.
+func (g *gistContainer) record(action string) *gistContainer {
+	if len(g.GistGetList) == 0 || g.jsonControl.Options["anonymous"].(bool) {
+		return g
+	}
+	e := ledgerNewEntry(g.jsonControl, g.workdir, g.jsonControl.Options["files"].(string))
+	e.Targets = append(e.Targets, ledgerGistTarget(action, g.GistGetList[len(g.GistGetList)-1]))
+	e.save(g.cfgdir)
+	return g
+}
+
+// record : Record the submissions of Slack.
+func (s *slackContainer) record() *slackContainer {
+	e := ledgerNewEntry(s.jsonControl, s.workdir, s.jsonControl.Options["file"].(string))
+	for _, fl := range s.slackParams.SlackResults {
+		e.Targets = append(e.Targets, ledgerSlackTarget("submit", fl))
+	}
+	e.save(s.cfgdir)
+	return s
+}
+
+// record : Record the submission of GitLab.
+func (g *gitlabContainer) record(r destResult) {
+	e := ledgerNewEntry(g.jsonControl, g.workdir, g.jsonControl.Options["file"].(string))
+	e.Targets = append(e.Targets, ledgerDestTarget(r, destinationCfg{Type: "gitlab", URL: g.Dest.baseURL, Project: g.Dest.project}))
+	e.save(g.cfgdir)
+}
+
+// record : Record the submission of the chat service.
+func (c *chatContainer) record() *chatContainer {
+	e := ledgerNewEntry(c.jsonControl, c.workdir, c.jsonControl.Options["file"].(string))
+	e.Targets = append(e.Targets, ledgerDestTarget(c.Result, c.Cfg))
+	e.save(c.cfgdir)
+	return c
+}
+
+// doubleRecord : Record the double submission. Submissions which were rolled back are recorded as failures.
+func (p *iniparamsContainer) doubleRecord(d *doubleResults) {
+	e := ledgerNewEntry(p.jsonControl, p.WorkDir, p.jsonControl.Options["file"].(string))
+	action := "submit"
+	if len(p.gistUpdateID()) > 0 {
+		action = "update"
+	}
+	e.Targets = append(e.Targets, ledgerGistTarget(action, d.Gist))
+	for _, sl := range d.Slacks {
+		e.Targets = append(e.Targets, ledgerSlackTarget("submit", sl))
+	}
+	if d.Webhook != nil {
+		t := ledgerTarget{
+			Destination: "slack-webhook",
+			Type:        "slack-webhook",
+			Action:      "submit",
+			OK:          d.Webhook.OK,
+			Error:       d.Webhook.Error,
+		}
+		e.Targets = append(e.Targets, t)
+	}
+	for _, rb := range d.Rollback {
+		for n, t := range e.Targets {
+			if rb.OK && t.ID == rb.ID && len(t.ID) > 0 {
+				e.Targets[n].OK = false
+				e.Targets[n].Error = "rolled back"
+			}
+		}
+	}
+	// The files replaced by "replace" are recorded as deleted so that undo of the original entry skips them.
+	for _, rb := range d.Replaced {
+		if rb.OK {
+			e.Targets = append(e.Targets, ledgerTarget{Destination: rb.Target, Type: rb.Target, Action: rb.Action, ID: rb.ID, OK: true})
+		}
+	}
+	e.save(p.CfgDir)
+}
+
+// ledgerDeleted : IDs of the submissions deleted by later entries like "replace". The values are the IDs of the entries which deleted them.
+func ledgerDeleted(entries []ledgerEntry) map[string]string {
+	deleted := map[string]string{}
+	for _, e := range entries {
+		for _, t := range e.Targets {
+			if t.Action == "delete" && t.OK && len(t.ID) > 0 {
+				deleted[t.ID] = e.ID
+			}
+		}
+	}
+	return deleted
+}
+
+// destRecord : Record the submissions to destinations.
+func (i *iniparamsContainer) destRecord(res *destResults) {
+	e := ledgerNewEntry(i.jsonControl, i.WorkDir, i.jsonControl.Options["file"].(string))
+	for _, r := range res.Results {
+		c := i.destinationCfgOf(r.Destination)
+		if len(c.Channel) == 0 {
+			c.Channel, _ = i.jsonControl.Options["channel"].(string)
+		}
+		e.Targets = append(e.Targets, ledgerDestTarget(r, c))
+	}
+	e.save(i.CfgDir)
+}
+
+// ledgerEntryOf : Retrieve the latest entry, which is not undone, including one of the IDs as a succeeded submission.
+func ledgerEntryOf(entries []ledgerEntry, ids []string) *ledgerEntry {
+	undone := map[string]bool{}
+	for _, e := range entries {
+		if len(e.Undo) > 0 {
+			undone[e.Undo] = true
+		}
+	}
+	for n := len(entries) - 1; n >= 0; n-- {
+		e := entries[n]
+		if len(e.Undo) > 0 || undone[e.ID] {
+			continue
+		}
+		for _, t := range e.Targets {
+			for _, id := range ids {
+				if t.OK && t.Action != "delete" && len(id) > 0 && strings.Contains(","+t.ID+",", ","+id+",") {
+					return &e
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ledgerHistory : Display entries of the ledger. "query" filters entries by ID, title, files and IDs of targets.
+func (i *iniparamsContainer) ledgerHistory() {
+	entries, err := ledgerRead(i.CfgDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	undone := map[string]string{}
+	var ar []ledgerEntry
+	query, _ := i.jsonControl.Options["query"].(string)
+	for _, e := range entries {
+		if len(e.Undo) > 0 {
+			undone[e.Undo] = e.ID
+			continue
+		}
+		if len(query) == 0 || e.match(query) {
+			ar = append(ar, e)
+		}
+	}
+	sort.SliceStable(ar, func(a, b int) bool { return ar[a].CreatedAt.After(ar[b].CreatedAt) })
+	if limit, _ := i.jsonControl.Options["limit"].(int); limit > 0 && len(ar) > limit {
+		ar = ar[:limit]
+	}
+	if len(ar) == 0 {
+		fmt.Println("No history.")
+		return
+	}
+	if i.jsonControl.Options["listasjson"].(bool) {
+		result, _ := json.MarshalIndent(ar, "", "  ")
+		fmt.Println(string(result))
+		return
+	}
+	buffer := &bytes.Buffer{}
+	w := new(tabwriter.Writer)
+	w.Init(buffer, 0, 4, 1, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", "# Entry", "# Created time", "# Command", "# Title", "# Targets", "# Undone")
+	for _, e := range ar {
+		var targets []string
+		for _, t := range e.Targets {
+			switch {
+			case t.OK && t.Action == "delete":
+				targets = append(targets, t.Destination+":"+t.ID+"(deleted)")
+			case t.OK:
+				targets = append(targets, t.Destination+":"+t.ID)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.ID,
+			e.CreatedAt.In(time.Local).Format("20060102_15:04:05"),
+			e.Command,
+			e.Title,
+			strings.Join(targets, " "),
+			undone[e.ID],
+		)
+	}
+	w.Flush()
+	fmt.Printf("%s", buffer)
+}
+
+// match : Check whether the entry includes the query.
+func (e *ledgerEntry) match(query string) bool {
+	if strings.Contains(e.ID, query) || strings.Contains(e.Title, query) {
+		return true
+	}
+	for _, f := range e.Files {
+		if strings.Contains(f.Path, query) || f.SHA256 == query {
+			return true
+		}
+	}
+	for _, t := range e.Targets {
+		if strings.Contains(t.ID, query) || t.URL == query {
+			return true
+		}
+	}
+	return false
+}
+
+// ledgerUndo : Delete all submissions of an entry. "last" means the latest entry which is not undone.
+// Created gists and files are deleted, and updated gists are reverted to the previous revision.
+func (i *iniparamsContainer) ledgerUndo(id string) {
+	entries, err := ledgerRead(i.CfgDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	undone := map[string]bool{}
+	for _, e := range entries {
+		if len(e.Undo) > 0 {
+			undone[e.Undo] = true
+		}
+	}
+	var target *ledgerEntry
+	for n := len(entries) - 1; n >= 0; n-- {
+		e := entries[n]
+		if len(e.Undo) > 0 || (id == "last" && undone[e.ID]) {
+			continue
+		}
+		if e.ID == id || id == "last" {
+			target = &e
+			break
+		}
+	}
+	if target == nil {
+		fmt.Fprintf(os.Stderr, "Error: Entry '%s' was not found in %s. You can check entries by '%s history'.\n", id, ledgerFile, appname)
+		os.Exit(1)
+	}
+	if undone[target.ID] {
+		fmt.Fprintf(os.Stderr, "Error: Entry '%s' has already been undone.\n", target.ID)
+		os.Exit(1)
+	}
+	u := &ledgerEntry{
+		Command:   "undo",
+		Title:     target.Title,
+		Undo:      target.ID,
+		CreatedAt: time.Now(),
+	}
+	deleted := ledgerDeleted(entries)
+	var failed bool
+	for _, t := range target.Targets {
+		// Deletions cannot be undone, and the submissions which have already been deleted by later entries are skipped.
+		if !t.OK || t.Action == "delete" || len(deleted[t.ID]) > 0 {
+			continue
+		}
+		r := i.ledgerUndoTarget(t)
+		failed = failed || !r.OK
+		u.Targets = append(u.Targets, r)
+	}
+	u.save(i.CfgDir)
+	var result []byte
+	if i.jsonControl.Options["jsonparser"].(bool) {
+		result, _ = json.MarshalIndent(u, "", "  ")
+	} else {
+		result, _ = json.Marshal(u)
+	}
+	fmt.Println(string(result))
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// ledgerUndoTarget : Delete or revert a submission of a target.
+func (i *iniparamsContainer) ledgerUndoTarget(t ledgerTarget) ledgerTarget {
+	r := ledgerTarget{
+		Destination: t.Destination,
+		Type:        t.Type,
+		Action:      "delete",
+		ID:          t.ID,
+		Workspace:   t.Workspace,
+		Channel:     t.Channel,
+	}
+	var res destResult
+	switch {
+	case t.Type == "gist" && t.Action == "update":
+		r.Action = "revert"
+		rb := i.ledgerRevertGist(t)
+		r.OK, r.Error = rb.OK, rb.Error
+		return r
+	case t.Type == "slack":
+		// An update of Slack is also an upload of new files.
+		d := &slackDest{
+			name:  t.Destination,
+			token: i.slackTokenOf(t.Workspace),
+		}
+		if c, ok := i.GislackCfg.Destinations[t.Destination]; ok && len(c.Token) > 0 {
+			d.token = c.Token
+		}
+		res = d.Delete(t.ID)
+	case t.Action != "submit":
+		r.Error = fmt.Sprintf("'%s' of %s cannot be undone.", t.Action, t.Type)
+		return r
+	default:
+		// The destination and the webhook are retrieved from gislack.cfg, because the ledger doesn't have the credentials.
+		c, ok := i.GislackCfg.Destinations[t.Destination]
+		switch {
+		case ok:
+		case t.Destination != t.Type:
+			r.Error = fmt.Sprintf("Destination '%s' is not found in %s.", t.Destination, cfgFile)
+			return r
+		case t.Webhook == "webhook-url":
+			r.Error = fmt.Sprintf("The URL of the webhook is not recorded in %s. Please delete it on %s.", ledgerFile, t.Type)
+			return r
+		default:
+			c = destinationCfg{
+				Type:      t.Type,
+				Workspace: t.Workspace,
+				Channel:   t.Channel,
+				Team:      t.Team,
+				Project:   t.Project,
+				Webhook:   t.Webhook,
+			}
+		}
+		newDest, ok := destinationTypes[c.Type]
+		if !ok {
+			r.Error = fmt.Sprintf("Type '%s' is not supported.", c.Type)
+			return r
+		}
+		d, err := newDest(i, t.Destination, c)
+		if err != nil {
+			r.Error = err.Error()
+			return r
+		}
+		res = d.Delete(t.ID)
+	}
+	r.OK, r.Error = res.OK, res.Error
+	return r
+}
+
+// ledgerRevertGist : Revert an updated gist to the revision before the update.
+func (i *iniparamsContainer) ledgerRevertGist(t ledgerTarget) doubleRollback {
+	token := i.GislackCfg.Gist.GistAccesstoken.Accesstoken
+	cur, err := gistSnapshotOf(token, t.ID)
+	if err != nil {
+		return doubleRollback{Target: "gist", ID: t.ID, Action: "revert", Error: err.Error()}
+	}
+	var prev string
+	for n, h := range cur.History {
+		if h.Version == t.Revision && n+1 < len(cur.History) {
+			prev = cur.History[n+1].Version
+		}
+	}
+	if len(prev) == 0 {
+		return doubleRollback{Target: "gist", ID: t.ID, Action: "revert", Error: fmt.Sprintf("The revision before '%s' was not found.", t.Revision)}
+	}
+	snapshot, err := gistSnapshotOf(token, t.ID+"/"+prev)
+	if err != nil {
+		return doubleRollback{Target: "gist", ID: t.ID, Action: "revert", Error: err.Error()}
+	}
+	return i.gistRollback(*cur, snapshot)
+}
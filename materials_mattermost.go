@@ -0,0 +1,222 @@
+// Package main (materials_mattermost.go) :
+// Materials for Mattermost. Files are uploaded with REST API v4 and posted to a channel.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tanaikech/gislack/utl"
+)
+
+// mattermostDest : A channel of Mattermost as a destination. ID of results is the post ID.
+type mattermostDest struct {
+	name        string
+	baseURL     string
+	accesstoken string
+	team        string
+	channelID   string
+}
+
+// mattermostPost : Post of Mattermost
+type mattermostPost struct {
+	ID        string   `json:"id"`
+	UserID    string   `json:"user_id"`
+	ChannelID string   `json:"channel_id"`
+	Message   string   `json:"message"`
+	CreateAt  int64    `json:"create_at"`
+	FileIDs   []string `json:"file_ids,omitempty"`
+	Metadata  struct {
+		Files []mattermostFileInfo `json:"files,omitempty"`
+	} `json:"metadata"`
+}
+
+// mattermostFileInfo : File information of Mattermost
+type mattermostFileInfo struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	CreateAt int64  `json:"create_at"`
+}
+
+// newMattermostDest : Create a destination of Mattermost. "url", "token", "team" and "channel" of the destination are used.
+// The channel is a channel name of the team or a channel ID.
+func newMattermostDest(i *iniparamsContainer, name string, c destinationCfg) (Destination, error) {
+	d := &mattermostDest{
+		name:        name,
+		baseURL:     i.GislackCfg.Mattermost.URL,
+		accesstoken: i.GislackCfg.Mattermost.Accesstoken,
+		team:        i.GislackCfg.Mattermost.Team,
+	}
+	if len(c.URL) > 0 {
+		d.baseURL = c.URL
+	}
+	if len(c.Token) > 0 {
+		d.accesstoken = c.Token
+	}
+	if len(c.Team) > 0 {
+		d.team = c.Team
+	}
+	d.baseURL = strings.TrimRight(d.baseURL, "/")
+	if len(d.baseURL) == 0 || len(d.accesstoken) == 0 {
+		return nil, fmt.Errorf("URL or access token of Mattermost is NOT found. Please run 'gislack auth --mattermosturl url --mattermosttoken token'")
+	}
+	channel := c.Channel
+	if len(channel) == 0 {
+		channel, _ = i.jsonControl.Options["channel"].(string)
+	}
+	channel = strings.TrimPrefix(strings.TrimSpace(channel), "#")
+	if len(channel) == 0 {
+		return nil, fmt.Errorf("Channel is NOT found. Please use '-ch' or 'channel' of the destination in %s", cfgFile)
+	}
+	if len(d.team) == 0 {
+		d.channelID = channel
+		return d, nil
+	}
+	body, err := d.api("GET", "teams/name/"+url.PathEscape(d.team)+"/channels/name/"+url.PathEscape(channel), nil, "").FetchAPI()
+	if err != nil {
+		return nil, fmt.Errorf("Channel '%s' of team '%s' was not found. [ %v ]", channel, d.team, err)
+	}
+	var ch struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(body, &ch)
+	d.channelID = ch.ID
+	return d, nil
+}
+
+// Name : Name of the destination
+func (d *mattermostDest) Name() string {
+	return d.name
+}
+
+// api : Create a request to REST API v4 of Mattermost.
+func (d *mattermostDest) api(method, path string, data io.Reader, contenttype string) *utl.RequestParams {
+	if len(contenttype) == 0 {
+		contenttype = "application/json"
+	}
+	return &utl.RequestParams{
+		Method:      method,
+		APIURL:      d.baseURL + "/api/v4/" + path,
+		Data:        data,
+		Contenttype: contenttype,
+		Accesstoken: d.accesstoken,
+		Dtime:       10,
+	}
+}
+
+// upload : Upload files to the channel, and return the file IDs.
+func (d *mattermostDest) upload(files []destFile) ([]string, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	b, ctype, err := chatMultipart(map[string]string{"channel_id": d.channelID}, files, func(int) string { return "files" })
+	if err != nil {
+		return nil, err
+	}
+	body, err := d.api("POST", "files", b, ctype).FetchAPI()
+	if err != nil {
+		return nil, fmt.Errorf("%v, %s", err, strings.TrimSpace(string(body)))
+	}
+	var res struct {
+		FileInfos []mattermostFileInfo `json:"file_infos"`
+	}
+	json.Unmarshal(body, &res)
+	var ids []string
+	for _, e := range res.FileInfos {
+		ids = append(ids, e.ID)
+	}
+	return ids, nil
+}
+
+// post : Create or patch a post, and set ID and URL of the post to the result.
+func (d *mattermostDest) post(action, method, path string, payload interface{}) destResult {
+	var data io.Reader
+	if payload != nil {
+		b, _ := json.Marshal(payload)
+		data = bytes.NewBuffer(b)
+	}
+	res, body := destFetch(d.name, "mattermost", action, d.api(method, path, data, ""))
+	if body != nil {
+		var p mattermostPost
+		json.Unmarshal(body, &p)
+		if len(p.ID) > 0 {
+			res.ID = p.ID
+			if len(d.team) > 0 {
+				res.URL = d.baseURL + "/" + d.team + "/pl/" + p.ID
+			}
+		}
+	}
+	return res
+}
+
+// Submit : Upload files and post them with the message.
+func (d *mattermostDest) Submit(p *destPayload) destResult {
+	ids, err := d.upload(p.Files)
+	if err != nil {
+		return destResult{Destination: d.name, Type: "mattermost", Action: "submit", Error: err.Error()}
+	}
+	return d.post("submit", "POST", "posts", map[string]interface{}{
+		"channel_id": d.channelID,
+		"message":    chatMessage(p),
+		"file_ids":   ids,
+	})
+}
+
+// Update : Upload files, and replace the message and the files of the post.
+func (d *mattermostDest) Update(id string, p *destPayload) destResult {
+	ids, err := d.upload(p.Files)
+	if err != nil {
+		return destResult{Destination: d.name, Type: "mattermost", Action: "update", ID: id, Error: err.Error()}
+	}
+	return d.post("update", "PUT", "posts/"+id+"/patch", map[string]interface{}{
+		"message":  chatMessage(p),
+		"file_ids": ids,
+	})
+}
+
+// Delete : Delete a post. The files of the post are also deleted.
+func (d *mattermostDest) Delete(id string) destResult {
+	res := d.post("delete", "DELETE", "posts/"+id, nil)
+	res.ID = id
+	return res
+}
+
+// Get : Retrieve a post.
+func (d *mattermostDest) Get(id string) destResult {
+	return d.post("get", "GET", "posts/"+id, nil)
+}
+
+// Files : Retrieve files from the latest 200 posts of the channel.
+func (d *mattermostDest) Files() ([]chatFile, error) {
+	body, err := d.api("GET", "channels/"+d.channelID+"/posts?per_page=200", nil, "").FetchAPI()
+	if err != nil {
+		return nil, fmt.Errorf("%v, %s", err, strings.TrimSpace(string(body)))
+	}
+	var pl struct {
+		Order []string                  `json:"order"`
+		Posts map[string]mattermostPost `json:"posts"`
+	}
+	json.Unmarshal(body, &pl)
+	var files []chatFile
+	for _, id := range pl.Order {
+		p := pl.Posts[id]
+		for _, f := range p.Metadata.Files {
+			files = append(files, chatFile{
+				ID:          f.ID,
+				Name:        f.Name,
+				MessageID:   p.ID,
+				User:        p.UserID,
+				Size:        f.Size,
+				URL:         d.baseURL + "/api/v4/files/" + f.ID,
+				CreatedTime: time.Unix(0, f.CreateAt*int64(time.Millisecond)),
+			})
+		}
+	}
+	return files, nil
+}
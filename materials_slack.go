@@ -4,6 +4,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,14 +14,13 @@ import (
 	"net/textproto"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
 
-	pb "gopkg.in/cheggaaa/pb.v1"
-
 	"github.com/tanaikech/gislack/utl"
 )
 
@@ -28,13 +28,17 @@ import (
 type slackParams struct {
 	Token          string
 	Channel        string
-	SlackPayload   slackPayload
 	SlackDelFile   slackDelFile
 	SlackFile      slackFile
 	SlackFilesList slackFilesList
 	SlackFileList  slackFileList
 	ChannelHistory channelHistory
 	ChannelList    channelList
+	Workspaces     map[string]string
+	SlackResults   []slackFileList
+	WebhookName    string
+	WebhookURL     string
+	Destinations   []*slackDestination
 }
 
 // slackContainer : Container included parameters
@@ -46,7 +50,30 @@ type slackContainer struct {
 
 // channelList : Channel list
 type channelList struct {
-	Channels []channelar `json:"channels"`
+	OK               bool        `json:"ok"`
+	Error            string      `json:"error,omitempty"`
+	Channels         []channelar `json:"channels"`
+	ResponseMetadata struct {
+		NextCursor string `json:"next_cursor"`
+	} `json:"response_metadata"`
+}
+
+// slackSimpleResult : Simple result of a submission to a channel
+type slackSimpleResult struct {
+	CreatedAt string `json:"slack_created_at,omitempty"`
+	ID        string `json:"slack_id,omitempty"`
+	Workspace string `json:"slack_workspace,omitempty"`
+	Channel   string `json:"slack_channel"`
+	Error     string `json:"error,omitempty"`
+}
+
+// slackDestination : Channels of a workspace for submitting
+type slackDestination struct {
+	Workspace  string
+	Token      string
+	Channels   []string
+	ChannelIDs []string
+	ThreadTs   string
 }
 
 // channelar :
@@ -69,37 +96,46 @@ type slackFilesList struct {
 
 // slackfiles : Struct for a file
 type slackfiles struct {
-	ID          string    `json:"id"`
-	Created     int64     `json:"created"`
-	CreatedTime time.Time `json:"createdtime"`
-	Name        string    `json:"name"`
-	Title       string    `json:"title"`
-	Filetype    string    `json:"filetype"`
-	User        string    `json:"user"`
-	Channels    []string  `json:"channels"`
+	ID             string    `json:"id"`
+	Created        int64     `json:"created"`
+	CreatedTime    time.Time `json:"createdtime"`
+	Name           string    `json:"name"`
+	Title          string    `json:"title"`
+	Filetype       string    `json:"filetype"`
+	Mimetype       string    `json:"mimetype"`
+	Size           int64     `json:"size"`
+	User           string    `json:"user"`
+	Channels       []string  `json:"channels"`
+	URLPrivate     string    `json:"url_private,omitempty"`
+	URLDownload    string    `json:"url_private_download,omitempty"`
+	InitialComment *struct {
+		Comment string `json:"comment"`
+	} `json:"initial_comment,omitempty"`
 }
 
 // channelHistory : Channel histories
 type channelHistory struct {
-	Latest   string `json:"latest"`
-	Messages []struct {
-		Type     string `json:"type"`
-		User     string `json:"user"`
-		Username string `json:"username"`
-		Text     string `json:"text"`
-		Ts       string `json:"ts"`
-	} `json:"messages"`
-	HasMore bool `json:"has_more"`
-}
-
-// slackPayload : Payload for requesting to Slack
-type slackPayload struct {
-	Content        string `json:"content,omitempty"`
-	Filename       string `json:"filename,omitempty"`
-	Filetype       string `json:"filetype,omitempty"`
-	Title          string `json:"title,omitempty"`
-	InitialComment string `json:"initial_comment,omitempty"`
-	Channels       string `json:"channels,omitempty"`
+	OK               bool             `json:"ok"`
+	Error            string           `json:"error,omitempty"`
+	Latest           string           `json:"latest"`
+	Messages         []channelMessage `json:"messages"`
+	HasMore          bool             `json:"has_more"`
+	ResponseMetadata struct {
+		NextCursor string `json:"next_cursor"`
+	} `json:"response_metadata"`
+}
+
+// channelMessage : A message in channel histories
+type channelMessage struct {
+	Type       string           `json:"type"`
+	User       string           `json:"user"`
+	Username   string           `json:"username"`
+	UserName   string           `json:"user_name,omitempty"`
+	Text       string           `json:"text"`
+	Ts         string           `json:"ts"`
+	ThreadTs   string           `json:"thread_ts,omitempty"`
+	ReplyCount int              `json:"reply_count,omitempty"`
+	Replies    []channelMessage `json:"thread_replies,omitempty"`
 }
 
 // slackInputJSON : Struct for submitting using JSON data
@@ -117,17 +153,31 @@ type slackInputJSON struct {
 type slackFileList struct {
 	OK   bool `json:"ok,omitempty"`
 	File struct {
-		ID          string    `json:"id,omitempty"`
-		Created     int64     `json:"created,omitempty"`
-		CreatedTime time.Time `json:"createdtime,omitempty"`
-		Name        string    `json:"name,omitempty"`
-		Title       string    `json:"title,omitempty"`
-		Filetype    string    `json:"filetype,omitempty"`
-		User        string    `json:"user,omitempty"`
-		Channels    []string  `json:"channels,omitempty"`
+		ID          string       `json:"id,omitempty"`
+		Created     int64        `json:"created,omitempty"`
+		CreatedTime time.Time    `json:"createdtime,omitempty"`
+		Name        string       `json:"name,omitempty"`
+		Title       string       `json:"title,omitempty"`
+		Filetype    string       `json:"filetype,omitempty"`
+		User        string       `json:"user,omitempty"`
+		Channels    []string     `json:"channels,omitempty"`
+		Shares      *slackShares `json:"shares,omitempty"`
 	} `json:"file,omitempty"`
-	Error   string `json:"error,omitempty"`
-	Channel string `json:"channel,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Channel   string `json:"channel,omitempty"`
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// slackShares : Shares of a file to public and private channels. Keys are channel IDs.
+type slackShares struct {
+	Public  map[string][]slackShare `json:"public,omitempty"`
+	Private map[string][]slackShare `json:"private,omitempty"`
+}
+
+// slackShare : A share of a file to a channel. ThreadTs is used when the file was shared as a reply.
+type slackShare struct {
+	Ts       string `json:"ts"`
+	ThreadTs string `json:"thread_ts,omitempty"`
 }
 
 // slackDelFile : Struct for deleting files
@@ -145,13 +195,32 @@ type slackError struct {
 type slackFile struct {
 	OK   bool `json:"ok"`
 	File struct {
-		Name        string    `json:"name,omitempty"`
-		MimeType    string    `json:"mimetype,omitempty"`
-		Title       string    `json:"title,omitempty"`
-		Created     int64     `json:"created,omitempty"`
-		CreatedTime time.Time `json:"createdtime,omitempty"`
+		ID             string       `json:"id,omitempty"`
+		Name           string       `json:"name,omitempty"`
+		MimeType       string       `json:"mimetype,omitempty"`
+		Filetype       string       `json:"filetype,omitempty"`
+		Size           int64        `json:"size,omitempty"`
+		Title          string       `json:"title,omitempty"`
+		Created        int64        `json:"created,omitempty"`
+		CreatedTime    time.Time    `json:"createdtime,omitempty"`
+		URLPrivate     string       `json:"url_private,omitempty"`
+		URLDownload    string       `json:"url_private_download,omitempty"`
+		Shares         *slackShares `json:"shares,omitempty"`
+		InitialComment *struct {
+			Comment string `json:"comment"`
+		} `json:"initial_comment,omitempty"`
 	} `json:"file,omitempty"`
 	Content string `json:"content,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// slackDownloaded : Result of downloading a file from Slack
+type slackDownloaded struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	MimeType string `json:"mimetype,omitempty"`
+	SavedTo  string `json:"saved_to,omitempty"`
+	Error    string `json:"error,omitempty"`
 }
 
 // slackChkAt : For checking slack access token
@@ -164,18 +233,25 @@ type slackChkAt struct {
 
 // initSlackContainer : Initialize parameters for Slack
 func (i *iniparamsContainer) initSlackContainer() *slackContainer {
+	i.slackRefreshTokens()
 	s := &slackContainer{
 		&initVal{
 			pstart: i.authParams.pstart,
 		},
 		&slackParams{
-			Token: i.authParams.GislackCfg.Slack.SlackAccesstoken.Accesstoken,
+			Token:      i.authParams.GislackCfg.Slack.SlackAccesstoken.tokenOf(i.slackTokenKind()),
+			Workspaces: map[string]string{},
 		},
 		&jsonControl{},
 	}
 	s.initVal.workdir = i.authParams.WorkDir
+	s.initVal.cfgdir = i.authParams.CfgDir
 	s.jsonControl = i.jsonControl
-	if len(s.Token) == 0 {
+	for name, app := range i.authParams.GislackCfg.Slack.Workspaces {
+		s.Workspaces[name] = app.SlackAccesstoken.tokenOf(i.slackTokenKind())
+	}
+	s.slackWebhookInit(i.authParams.GislackCfg.Slack.Webhooks)
+	if len(s.Token) == 0 && !s.slackWebhookMode() {
 		fmt.Fprintf(os.Stderr, "Error: Access token of Slack is NOT found. Please retrieve Client ID and Client Secret from Slack, and run 'gislack auth -si clientid -ss clientsecret'.\n")
 		os.Exit(1)
 	}
@@ -184,25 +260,63 @@ func (i *iniparamsContainer) initSlackContainer() *slackContainer {
 
 // slackGetChannels : Retrieve channel list
 func (s *slackContainer) slackGetChannels() *slackContainer {
-	p := url.Values{}
-	p.Set("token", s.slackParams.Token)
-	r := &utl.RequestParams{
-		Method: "GET",
-		// APIURL: slackurl + "channels.list?" + p.Encode(),  // Old endpoint
-		APIURL:      slackurl + "conversations.list?" + p.Encode(), // New endpoint
-		Data:        nil,
-		Contenttype: "application/x-www-form-urlencoded",
-		Dtime:       10,
-	}
-	body, err := r.FetchAPI()
+	cl, err := slackListChannels(s.slackParams.Token)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
-	json.Unmarshal(body, &s.ChannelList)
+	s.ChannelList = cl
 	return s
 }
 
+// slackListChannels : Retrieve all channels of a workspace using token.
+func slackListChannels(token string) (channelList, error) {
+	var cl channelList
+	var cursor string
+	for {
+		p := url.Values{}
+		p.Set("token", token)
+		p.Set("limit", strconv.Itoa(1000))
+		p.Set("exclude_archived", "true")
+		p.Set("cursor", cursor)
+		r := &utl.RequestParams{
+			Method: "GET",
+			// APIURL: slackurl + "channels.list?" + p.Encode(),  // Old endpoint
+			APIURL:      slackurl + "conversations.list?" + p.Encode(), // New endpoint
+			Data:        nil,
+			Contenttype: "application/x-www-form-urlencoded",
+			Dtime:       10,
+		}
+		body, err := r.FetchAPI()
+		if err != nil {
+			return cl, err
+		}
+		var c channelList
+		json.Unmarshal(body, &c)
+		if !c.OK {
+			return cl, fmt.Errorf("%s", c.Error)
+		}
+		cl.OK = true
+		cl.Channels = append(cl.Channels, c.Channels...)
+		cursor = c.ResponseMetadata.NextCursor
+		if len(cursor) == 0 {
+			break
+		}
+	}
+	return cl, nil
+}
+
+// nameToID : Convert a channel name to channel ID. "#" of the name is ignored and channel ID can be also used.
+func (cl channelList) nameToID(name string) (string, bool) {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "#")
+	for _, e := range cl.Channels {
+		if name == e.Name || name == e.ID {
+			return e.ID, true
+		}
+	}
+	return "", false
+}
+
 // slackDispChannel : Display retrieved channale list
 func (s *slackContainer) slackDispChannel() {
 	if len(s.ChannelList.Channels) == 0 {
@@ -308,11 +422,38 @@ func (s *slackContainer) slackDispFiles() {
 	return
 }
 
-// slackGetFile : Get file from file ID.
+// slackGetFile : Get file from file ID. The content is downloaded from url_private_download.
 func (s *slackContainer) slackGetFile() {
+	s.slackGetFileInfo(s.jsonControl.Options["getfile"].(string))
+	out := s.jsonControl.Options["out"].(string)
+	if s.jsonControl.Options["stdout"].(bool) {
+		if err := s.slackDownload(s.slackParams.SlackFile.File.URLDownload, s.slackParams.SlackFile.File.URLPrivate, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	outfile := s.slackOutPath(out, s.slackParams.SlackFile.File.Name)
+	if err := s.slackSaveFile(s.slackParams.SlackFile.File.URLDownload, s.slackParams.SlackFile.File.URLPrivate, outfile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	} else {
+		s.slackParams.SlackFile.Content = fmt.Sprintf("Content was saved to a file (%s).", outfile)
+	}
+	if s.jsonControl.Options["usejsoncontrol"].(bool) {
+		result, _ := json.Marshal(s.slackParams.SlackFile)
+		fmt.Println(string(result))
+		return
+	}
+	result, _ := json.MarshalIndent(s.slackParams.SlackFile, "", "  ")
+	fmt.Println(string(result))
+	return
+}
+
+// slackGetFileInfo : Retrieve information of a file from file ID.
+func (s *slackContainer) slackGetFileInfo(id string) *slackContainer {
 	p := url.Values{}
 	p.Set("token", s.slackParams.Token)
-	p.Set("file", s.jsonControl.Options["getfile"].(string))
+	p.Set("file", id)
 	r := &utl.RequestParams{
 		Method:      "POST",
 		APIURL:      slackurl + "files.info?" + p.Encode(),
@@ -326,71 +467,260 @@ func (s *slackContainer) slackGetFile() {
 		os.Exit(1)
 	}
 	json.Unmarshal(body, &s.slackParams.SlackFile)
+	if !s.slackParams.SlackFile.OK {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", s.slackParams.SlackFile.Error)
+		os.Exit(1)
+	}
 	s.slackParams.SlackFile.File.CreatedTime = time.Unix(s.slackParams.SlackFile.File.Created, 0)
+	return s
+}
 
-	if s.jsonControl.Options["usejsoncontrol"].(bool) {
-		result, _ := json.Marshal(s.slackParams.SlackFile)
-		fmt.Println(string(result))
+// slackGetAllFiles : Download all files retrieved by the file list to a directory.
+func (s *slackContainer) slackGetAllFiles() {
+	ar := s.slackParams.SlackFilesList.Files
+	if len(ar) == 0 {
+		fmt.Println("No files.")
 		return
 	}
-	outfile := strings.TrimSpace(s.slackParams.SlackFile.File.Name)
-	if _, err := os.Stat(outfile); err == nil {
-		fmt.Fprintf(os.Stderr, "Error: %s already exists. Content was not saved to a file.\n", outfile)
+	dir := s.jsonControl.Options["out"].(string)
+	if len(dir) == 0 {
+		dir = s.workdir
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	var results []slackDownloaded
+	bar := newProgressBar(len(ar))
+	for _, e := range ar {
+		bar.Increment()
+		d := slackDownloaded{
+			ID:       e.ID,
+			Name:     e.Name,
+			MimeType: e.Mimetype,
+		}
+		outfile := filepath.Join(dir, filepath.Base(strings.TrimSpace(e.Name)))
+		if _, err := os.Stat(outfile); err == nil {
+			outfile = filepath.Join(dir, e.ID+"_"+filepath.Base(strings.TrimSpace(e.Name)))
+		}
+		if err := s.slackSaveFile(e.URLDownload, e.URLPrivate, outfile); err != nil {
+			d.Error = err.Error()
+		} else {
+			d.SavedTo = outfile
+		}
+		results = append(results, d)
+	}
+	bar.FinishPrint("Done.")
+	var result []byte
+	if s.jsonControl.Options["jsonparser"].(bool) {
+		result, _ = json.MarshalIndent(results, "", "  ")
 	} else {
-		ioutil.WriteFile(filepath.Join(s.workdir, outfile), []byte(s.slackParams.SlackFile.Content), 0777)
-		s.slackParams.SlackFile.Content = fmt.Sprintf("Content was saved to a file (%s).", outfile)
+		result, _ = json.Marshal(results)
 	}
-	result, _ := json.MarshalIndent(s.slackParams.SlackFile, "", "  ")
 	fmt.Println(string(result))
 	return
 }
 
+// slackOutPath : Decide the path for saving a file. When "out" is a directory, the original filename is used in it.
+func (s *slackContainer) slackOutPath(out, name string) string {
+	name = filepath.Base(strings.TrimSpace(name))
+	if len(out) == 0 {
+		return filepath.Join(s.workdir, name)
+	}
+	if st, err := os.Stat(out); err == nil && st.IsDir() {
+		return filepath.Join(out, name)
+	}
+	return out
+}
+
+// slackSaveFile : Save a file of Slack to outfile. An existing file is not overwritten.
+func (s *slackContainer) slackSaveFile(downloadURL, privateURL, outfile string) error {
+	if _, err := os.Stat(outfile); err == nil {
+		return fmt.Errorf("%s already exists. Content was not saved to a file", outfile)
+	}
+	f, err := os.Create(outfile)
+	if err != nil {
+		return err
+	}
+	err = s.slackDownload(downloadURL, privateURL, f)
+	f.Close()
+	if err != nil {
+		os.Remove(outfile)
+		return err
+	}
+	return nil
+}
+
+// slackDownload : Stream a file from url_private_download (or url_private) to w using the access token.
+func (s *slackContainer) slackDownload(downloadURL, privateURL string, w io.Writer) error {
+	u := downloadURL
+	if len(u) == 0 {
+		u = privateURL
+	}
+	if len(u) == 0 {
+		return fmt.Errorf("no download URL for this file")
+	}
+	r := &utl.RequestParams{
+		Method:      "GET",
+		APIURL:      u,
+		Data:        nil,
+		Accesstoken: s.slackParams.Token,
+		Dtime:       0,
+	}
+	res, err := r.FetchAPIres()
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode-300 >= 0 {
+		return fmt.Errorf("status code: %d", res.StatusCode)
+	}
+	if strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		return fmt.Errorf("Slack returned a login page. The access token may not have 'files:read' scope")
+	}
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
 // slackChannelNameToID : Convert from name to ID for Slack channel
 func (s *slackContainer) slackChannelNameToID() string {
-	for _, e := range s.ChannelList.Channels {
-		if s.jsonControl.Options["channel"].(string) == e.Name {
-			return e.ID
+	id, ok := s.ChannelList.nameToID(s.jsonControl.Options["channel"].(string))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: Channel '%s' was not found.\n", s.jsonControl.Options["channel"].(string))
+		os.Exit(1)
+	}
+	return id
+}
+
+// slackResolveDestinations : Resolve channels of "channel" to destinations of each workspace.
+// Channels are separated by ",", and a channel of other workspace is given as "workspace:channel".
+// All channels are validated before any submission. Files are submitted to each channel, so the result is given for each channel.
+func (s *slackContainer) slackResolveDestinations() []*slackDestination {
+	if s.slackParams.Destinations != nil {
+		return s.slackParams.Destinations
+	}
+	var dests []*slackDestination
+	find := func(ws string) *slackDestination {
+		for _, d := range dests {
+			if d.Workspace == ws {
+				return d
+			}
+		}
+		d := &slackDestination{Workspace: ws}
+		dests = append(dests, d)
+		return d
+	}
+	for _, e := range strings.Split(s.jsonControl.Options["channel"].(string), ",") {
+		if e = strings.TrimSpace(e); len(e) == 0 {
+			continue
+		}
+		var ws string
+		if i := strings.Index(e, ":"); i >= 0 {
+			ws, e = e[:i], e[i+1:]
+		}
+		d := find(ws)
+		d.Channels = append(d.Channels, e)
+	}
+	if len(dests) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: Please input channel name using '-ch'.\n")
+		os.Exit(1)
+	}
+	var errs []string
+	for _, d := range dests {
+		if len(d.Workspace) == 0 {
+			d.Token = s.slackParams.Token
+		} else if token, ok := s.slackParams.Workspaces[d.Workspace]; ok && len(token) > 0 {
+			d.Token = token
+		} else {
+			errs = append(errs, fmt.Sprintf("Workspace '%s' is not found in %s. Please run '%s auth -si clientid -ss clientsecret --workspace %s'.", d.Workspace, cfgFile, appname, d.Workspace))
+			continue
+		}
+		cl, err := slackListChannels(d.Token)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("Channels of workspace '%s' couldn't be retrieved. [ %v ]", d.Workspace, err))
+			continue
+		}
+		for _, ch := range d.Channels {
+			id, ok := cl.nameToID(ch)
+			if !ok {
+				errs = append(errs, fmt.Sprintf("Channel '%s' was not found.", func() string {
+					if len(d.Workspace) > 0 {
+						return d.Workspace + ":" + ch
+					}
+					return ch
+				}()))
+				continue
+			}
+			d.ChannelIDs = append(d.ChannelIDs, id)
 		}
 	}
-	return fmt.Sprintf("No channel ID for %s.", s.jsonControl.Options["channel"].(string))
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: Nothing was submitted.\n  %s\n", strings.Join(errs, "\n  "))
+		os.Exit(1)
+	}
+	s.slackParams.Destinations = dests
+	return dests
 }
 
-// slackGetChannelHistory : Retrieve channel histories
+// slackGetChannelHistory : Retrieve channel histories. Messages are filtered by since, until, user and contains.
 func (s *slackContainer) slackGetChannelHistory() *slackContainer {
 	if len(s.jsonControl.Options["channel"].(string)) == 0 {
 		fmt.Fprintf(os.Stderr, "Error: Please input channel name using '-ch'.\n")
 		os.Exit(1)
 	}
-	p := url.Values{}
-	p.Set("token", s.slackParams.Token)
-	p.Set("channel", s.slackGetChannels().slackChannelNameToID())
-	p.Set("latest", s.ChannelHistory.Latest)
-	p.Set("count", strconv.FormatInt(1000, 10))
-	r := &utl.RequestParams{
-		Method: "POST",
-		// APIURL:      slackurl + "channels.history?" + p.Encode(),  // Old endpoint
-		APIURL:      slackurl + "conversations.history?" + p.Encode(), // New endpoint
-		Data:        nil,
-		Contenttype: "application/x-www-form-urlencoded",
-		Dtime:       10,
-	}
-	body, err := r.FetchAPI()
+	f, err := s.slackHistoryFilter()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-	var ch channelHistory
-	json.Unmarshal(body, &ch)
-	s.ChannelHistory.Messages = append(s.ChannelHistory.Messages, ch.Messages...)
-	if ch.HasMore {
-		s.ChannelHistory.Latest = ch.Messages[len(ch.Messages)-1].Ts
-		s.slackGetChannelHistory()
+	channel := s.slackGetChannels().slackChannelNameToID()
+	var cursor string
+	for {
+		p := url.Values{}
+		p.Set("token", s.slackParams.Token)
+		p.Set("channel", channel)
+		p.Set("oldest", f.Oldest)
+		p.Set("latest", f.Latest)
+		p.Set("limit", strconv.Itoa(200))
+		p.Set("cursor", cursor)
+		r := &utl.RequestParams{
+			Method: "POST",
+			// APIURL:      slackurl + "channels.history?" + p.Encode(),  // Old endpoint
+			APIURL:      slackurl + "conversations.history?" + p.Encode(), // New endpoint
+			Data:        nil,
+			Contenttype: "application/x-www-form-urlencoded",
+			Dtime:       10,
+		}
+		body, err := r.FetchAPI()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		var ch channelHistory
+		json.Unmarshal(body, &ch)
+		if !ch.OK {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", ch.Error)
+			os.Exit(1)
+		}
+		for _, e := range ch.Messages {
+			if f.match(e) {
+				s.ChannelHistory.Messages = append(s.ChannelHistory.Messages, e)
+			}
+		}
+		cursor = ch.ResponseMetadata.NextCursor
+		if !ch.HasMore || len(cursor) == 0 {
+			break
+		}
 	}
 	return s
 }
 
 // slackDispChannelHistory : Display channel histories
 func (s *slackContainer) slackDispChannelHistory() {
+	if format := s.jsonControl.Options["format"].(string); len(format) > 0 && format != "table" {
+		s.slackExportChannelHistory(format)
+		return
+	}
 	ar := s.ChannelHistory.Messages
 	if len(ar) > 0 {
 		buffer := &bytes.Buffer{}
@@ -425,101 +755,128 @@ func (s *slackContainer) slackDispChannelHistory() {
 	}
 }
 
-// slackSubmit : Submit a file
+// slackSubmit : Submit a file or the content to all channels of the destinations. The result is given for each channel.
 func (s *slackContainer) slackSubmit() *slackContainer {
-	if len(s.jsonControl.Options["file"].(string)) > 0 {
-		s.slackParams.SlackPayload.Filename = s.jsonControl.Options["file"].(string)
-	}
-	if len(s.jsonControl.Options["file"].(string)) == 0 {
-		s.slackParams.SlackPayload.Content = s.jsonControl.Options["content"].(string)
-	}
-	s.slackParams.SlackPayload.Title = s.jsonControl.Options["title"].(string)
-	s.slackParams.SlackPayload.Filetype = s.jsonControl.Options["filetype"].(string)
-	s.slackParams.SlackPayload.Channels = s.slackGetChannels().slackChannelNameToID()
-	s.slackParams.SlackPayload.InitialComment = s.jsonControl.Options["initialcomment"].(string)
-	var file string
-	if filepath.Dir(s.slackParams.SlackPayload.Filename) == "." {
-		file = filepath.Join(s.workdir, s.slackParams.SlackPayload.Filename)
-	} else {
-		file = s.slackParams.SlackPayload.Filename
-	}
-	r := &utl.RequestParams{}
-	if len(file) > 0 {
-		p := url.Values{}
-		p.Set("token", s.slackParams.Token)
-		p.Set("channels", s.slackParams.SlackPayload.Channels)
-		p.Set("title", s.slackParams.SlackPayload.Title)
-		p.Set("filetype", s.slackParams.SlackPayload.Filetype)
-		p.Set("initial_comment", s.slackParams.SlackPayload.InitialComment)
-		p.Set("filename", filepath.Base(file))
-		var b bytes.Buffer
-		w := multipart.NewWriter(&b)
-		part := make(textproto.MIMEHeader)
-		data, err := w.CreatePart(part)
+	dests := s.slackResolveDestinations()
+	p := s.slackDestPayload()
+	if file := s.jsonControl.Options["file"].(string); len(file) > 0 {
+		f, err := s.slackReadFile(file)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v. ", err)
 			os.Exit(1)
 		}
-		fs, err := os.Open(file)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v. ", err)
-			os.Exit(1)
-		}
-		defer fs.Close()
-		data, err = w.CreateFormFile("file", file)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v. ", err)
-			os.Exit(1)
-		}
-		if _, err = io.Copy(data, fs); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v. ", err)
-			os.Exit(1)
-		}
-		w.Close()
-		r = &utl.RequestParams{
-			Method:      "POST",
-			APIURL:      slackurl + "files.upload?" + p.Encode(),
-			Data:        &b,
-			Contenttype: w.FormDataContentType(),
-			Dtime:       10,
-		}
-	} else if len(file) == 0 {
-		p := url.Values{}
-		p.Set("token", s.slackParams.Token)
-		p.Set("channels", s.slackParams.SlackPayload.Channels)
-		p.Set("title", s.slackParams.SlackPayload.Title)
-		p.Set("filetype", s.slackParams.SlackPayload.Filetype)
-		p.Set("initial_comment", s.slackParams.SlackPayload.InitialComment)
-		p.Set("content", s.slackParams.SlackPayload.Content)
-		r = &utl.RequestParams{
-			Method:      "POST",
-			APIURL:      slackurl + "files.upload?" + p.Encode(),
-			Data:        nil,
-			Contenttype: "application/x-www-form-urlencoded",
-			Dtime:       10,
-		}
+		p.Files = append(p.Files, f)
+	} else {
+		p.Content = s.jsonControl.Options["content"].(string)
 	}
-	body, err := r.FetchAPI()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v. ", err)
-		os.Exit(1)
+	for _, d := range dests {
+		for n, e := range d.dests() {
+			fl := slackFileListOf(e.Submit(p))
+			fl.Channel = d.Channels[n]
+			fl.Workspace = d.Workspace
+			s.slackParams.SlackResults = append(s.slackParams.SlackResults, fl)
+		}
 	}
-	json.Unmarshal(body, &s.slackParams.SlackFileList)
-	if !s.slackParams.SlackFileList.OK {
+	s.record()
+	s.slackParams.SlackFileList = s.slackParams.SlackResults[0]
+	if len(s.slackParams.SlackResults) == 1 && !s.slackParams.SlackFileList.OK {
 		fmt.Printf("Error: %s\n", s.slackParams.SlackFileList.Error)
 		os.Exit(1)
 	}
-	s.slackParams.SlackFileList.File.CreatedTime = time.Unix(s.slackParams.SlackFileList.File.Created, 0)
 	if s.jsonControl.Options["simpleresult"].(bool) {
-		fmt.Printf(
-			"{\"slack_created_at\": \"%s\", \"slack_id\": \"%s\"}\n",
-			s.slackParams.SlackFileList.File.CreatedTime.Format("20060102_15:04:05"),
-			s.slackParams.SlackFileList.File.ID,
-		)
+		for _, e := range s.slackParams.SlackResults {
+			r := slackSimpleResult{
+				Workspace: e.Workspace,
+				Channel:   e.Channel,
+			}
+			if e.OK {
+				r.CreatedAt = e.File.CreatedTime.Format("20060102_15:04:05")
+				r.ID = e.File.ID
+			} else {
+				r.Error = e.Error
+			}
+			result, _ := json.Marshal(r)
+			fmt.Println(string(result))
+		}
 	}
 	return s
 }
 
+// slackDestPayload : Create a payload for Slack with title, filetype and initialcomment.
+func (s *slackContainer) slackDestPayload() *destPayload {
+	return &destPayload{
+		Title:    s.jsonControl.Options["title"].(string),
+		Comment:  s.jsonControl.Options["initialcomment"].(string),
+		Filetype: s.jsonControl.Options["filetype"].(string),
+	}
+}
+
+// slackReadFile : Read a file for Slack. A file without the directory is read from the working directory.
+func (s *slackContainer) slackReadFile(file string) (destFile, error) {
+	fpath := file
+	if filepath.Dir(file) == "." {
+		fpath = filepath.Join(s.workdir, file)
+	}
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return destFile{}, err
+	}
+	return destFile{Name: filepath.Base(file), Data: data}, nil
+}
+
+// dests : Destinations for each channel. Files are submitted to each channel, so a failure of a channel doesn't affect the other channels.
+func (d *slackDestination) dests() []*slackDest {
+	var ds []*slackDest
+	for n, id := range d.ChannelIDs {
+		ds = append(ds, &slackDest{
+			name:       "slack",
+			token:      d.Token,
+			channels:   d.Channels[n],
+			channelIDs: []string{id},
+			threadTs:   d.ThreadTs,
+		})
+	}
+	return ds
+}
+
+// slackFileListOf : Convert a result of slackDest to the response of files.upload.
+func slackFileListOf(r destResult) slackFileList {
+	var fl slackFileList
+	json.Unmarshal(r.Response, &fl)
+	if !r.OK && len(fl.Error) == 0 {
+		fl.Error = r.Error
+	}
+	fl.File.CreatedTime = time.Unix(fl.File.Created, 0)
+	return fl
+}
+
+// slackMultipartReq : Create a request for uploading a file as multipart/form-data.
+func slackMultipartReq(token string, p url.Values, file string, fs io.Reader) (*utl.RequestParams, error) {
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	part := make(textproto.MIMEHeader)
+	data, err := w.CreatePart(part)
+	if err != nil {
+		return nil, err
+	}
+	data, err = w.CreateFormFile("file", file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(data, fs); err != nil {
+		return nil, err
+	}
+	w.Close()
+	return &utl.RequestParams{
+		Method:      "POST",
+		APIURL:      slackurl + "files.upload?" + p.Encode(),
+		Data:        &b,
+		Contenttype: w.FormDataContentType(),
+		Accesstoken: token,
+		Dtime:       10,
+	}, nil
+}
+
 // slackDeleteFile : Delete a file
 func (s *slackContainer) slackDeleteFile() {
 	p := url.Values{}
@@ -548,6 +905,7 @@ func (s *slackContainer) slackDeleteFile() {
 }
 
 // slackDeleteAllFiles : Delete all files.
+// When SIGINT is received, the request in progress is canceled and reported as unknown.
 func (s *slackContainer) slackDeleteAllFiles() {
 	p := url.Values{}
 	p.Set("token", s.slackParams.Token)
@@ -573,9 +931,12 @@ func (s *slackContainer) slackDeleteAllFiles() {
 		ar := s.slackParams.SlackFilesList.Files
 		count := len(ar)
 		if count > 0 {
-			bar := pb.StartNew(count)
-			for i := 0; i < count; i++ {
-				bar.Increment()
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			var done []string
+			var canceled string
+			bar := newProgressBar(count)
+			for i := 0; i < count && ctx.Err() == nil; i++ {
 				p := url.Values{}
 				p.Set("token", s.slackParams.Token)
 				p.Set("file", ar[i].ID)
@@ -585,13 +946,26 @@ func (s *slackContainer) slackDeleteAllFiles() {
 					Data:        nil,
 					Contenttype: "application/x-www-form-urlencoded",
 					Dtime:       10,
+					Context:     ctx,
 				}
 				body, err := r.FetchAPI()
+				if err != nil && ctx.Err() != nil {
+					canceled = ar[i].ID
+					break
+				}
 				var se slackError
 				if json.Unmarshal(body, &se); err != nil || !se.OK {
+					bar.Finish()
 					fmt.Fprintf(os.Stderr, "\nError: [ %s ] Overuse of API, or owner of this channel may not be you.\n", se.Error)
+					dispBulkResult("files", done, count, false, "")
 					os.Exit(1)
 				}
+				done = append(done, ar[i].ID)
+				bar.Increment()
+			}
+			if ctx.Err() != nil {
+				bar.Finish()
+				dispBulkResult("files", done, count, true, canceled)
 			}
 			bar.FinishPrint("Done.")
 		} else {
@@ -626,49 +1000,211 @@ func (s *slackContainer) slackDeleteHistory() {
 	}
 }
 
-// slackDeleteChannelAllHistory : Delete histories. But it can delete just 50 histories at once.
-func (s *slackContainer) slackDeleteChannelAllHistory() {
-	fmt.Printf("# 50 histories can be deleted for one time, because of the limitation.\n")
-	fmt.Printf("# If you want to delete a lot of histories, please run several times.\n")
-	fmt.Printf("# Histories are deleted in order of the old date.\n")
-	ar := s.ChannelHistory.Messages
-	count := len(ar)
-	if count > 0 {
-		var numdel int
-		if s.jsonControl.Options["deletehistories"].(int) < 50 {
-			numdel = s.jsonControl.Options["deletehistories"].(int)
-		} else {
-			numdel = 50
-		}
-		if count < numdel {
-			numdel = count
-		}
-		var j int
-		bar := pb.StartNew(numdel)
-		for i := count - numdel; i < count; i++ {
-			j = (count - 1) - (i - count + numdel)
-			bar.Increment()
-			p := url.Values{}
-			p.Set("token", s.slackParams.Token)
-			p.Set("ts", ar[j].Ts)
-			p.Set("channel", s.slackGetChannels().slackChannelNameToID())
-			r := &utl.RequestParams{
-				Method:      "POST",
-				APIURL:      slackurl + "chat.delete?" + p.Encode(),
-				Data:        nil,
-				Contenttype: "application/x-www-form-urlencoded",
-				Dtime:       10,
-			}
-			body, err := r.FetchAPI()
-			var se slackError
-			if json.Unmarshal(body, &se); err != nil || !se.OK {
-				fmt.Fprintf(os.Stderr, "\nError: [ %s, %s ] Overuse of API, or owner of this channel may not be you.\n", se.Error, err)
-				os.Exit(1)
-			}
+// slackDest : Channels of Slack as a destination. When threadTs is used, the files are shared as replies of the message.
+type slackDest struct {
+	name       string
+	token      string
+	channels   string
+	channelIDs []string
+	threadTs   string
+}
+
+// newSlackDest : Create a destination of Slack. "workspace" and "channel" of the destination are used.
+// When "channel" of the destination is empty, the channel of '-ch' is used. Channels are validated here.
+func newSlackDest(i *iniparamsContainer, name string, c destinationCfg) (Destination, error) {
+	i.slackRefreshTokens()
+	d := &slackDest{
+		name:     name,
+		token:    i.GislackCfg.Slack.SlackAccesstoken.tokenOf(i.slackTokenKind()),
+		channels: c.Channel,
+	}
+	if len(c.Workspace) > 0 {
+		app, ok := i.GislackCfg.Slack.Workspaces[c.Workspace]
+		if !ok {
+			return nil, fmt.Errorf("Workspace '%s' is not found in %s", c.Workspace, cfgFile)
 		}
-		bar.FinishPrint("Done.")
-	} else {
-		fmt.Printf("No history in channel %s.\n", s.jsonControl.Options["channel"].(string))
+		d.token = app.SlackAccesstoken.tokenOf(i.slackTokenKind())
 	}
-	return
+	if len(c.Token) > 0 {
+		d.token = c.Token
+	}
+	if len(d.token) == 0 {
+		return nil, fmt.Errorf("Access token of Slack is NOT found. Please run 'gislack auth -si clientid -ss clientsecret'")
+	}
+	if len(d.channels) == 0 {
+		d.channels, _ = i.jsonControl.Options["channel"].(string)
+	}
+	if len(d.channels) == 0 {
+		return nil, fmt.Errorf("Channel is NOT found. Please use '-ch' or 'channel' of the destination in %s", cfgFile)
+	}
+	cl, err := slackListChannels(d.token)
+	if err != nil {
+		return nil, fmt.Errorf("Channels couldn't be retrieved. [ %v ]", err)
+	}
+	for _, ch := range strings.Split(d.channels, ",") {
+		id, ok := cl.nameToID(strings.TrimSpace(ch))
+		if !ok {
+			return nil, fmt.Errorf("Channel '%s' was not found", ch)
+		}
+		d.channelIDs = append(d.channelIDs, id)
+	}
+	return d, nil
+}
+
+// slackTokenOf : Access token of the workspace. When the workspace is empty or not found, the default access token is returned.
+func (i *iniparamsContainer) slackTokenOf(workspace string) string {
+	i.slackRefreshTokens()
+	if app, ok := i.GislackCfg.Slack.Workspaces[workspace]; ok && len(workspace) > 0 {
+		return app.SlackAccesstoken.tokenOf(i.slackTokenKind())
+	}
+	return i.GislackCfg.Slack.SlackAccesstoken.tokenOf(i.slackTokenKind())
+}
+
+// slackTokenKind : Kind of the token used by the command. The user token is used for deleting own messages and with "as-user".
+// For the other commands, the bot token is used. When the token of the kind is not found, the other token is used.
+func (i *iniparamsContainer) slackTokenKind() string {
+	if asUser, _ := i.jsonControl.Options["as-user"].(bool); asUser {
+		return "user"
+	}
+	if i.jsonControl.Command == "slack" {
+		h, _ := i.jsonControl.Options["deletehistory"].(string)
+		n, _ := i.jsonControl.Options["deletehistories"].(int)
+		all, _ := i.jsonControl.Options["deleteallhistories"].(bool)
+		if len(h) > 0 || n > 0 || all {
+			return "user"
+		}
+	}
+	return "bot"
+}
+
+// Name : Name of the destination
+func (d *slackDest) Name() string {
+	return d.name
+}
+
+// Submit : Upload each file to the channels. ID of the result is the file IDs separated by ",".
+// When the payload has no files, the content is submitted as a text.
+func (d *slackDest) Submit(p *destPayload) destResult {
+	res := destResult{
+		Destination: d.name,
+		Type:        "slack",
+		Action:      "submit",
+		OK:          true,
+	}
+	q := url.Values{}
+	q.Set("token", d.token)
+	q.Set("channels", strings.Join(d.channelIDs, ","))
+	q.Set("title", p.Title)
+	q.Set("filetype", p.Filetype)
+	q.Set("initial_comment", p.Comment)
+	if len(d.threadTs) > 0 {
+		q.Set("thread_ts", d.threadTs)
+	}
+	var ids, errs []string
+	var responses []json.RawMessage
+	upload := func(label string, r *utl.RequestParams) {
+		e, body := destFetch(d.name, "slack", "submit", r)
+		res.mergeStatus(e)
+		var fl slackFileList
+		json.Unmarshal(body, &fl)
+		switch {
+		case !e.OK:
+			errs = append(errs, fmt.Sprintf("%s: %s", label, e.Error))
+		case !fl.OK:
+			errs = append(errs, fmt.Sprintf("%s: %s", label, fl.Error))
+		default:
+			ids = append(ids, fl.File.ID)
+		}
+		if e.Response != nil {
+			responses = append(responses, e.Response)
+		}
+	}
+	if len(p.Files) == 0 {
+		q.Set("content", p.Content)
+		upload("content", &utl.RequestParams{
+			Method:      "POST",
+			APIURL:      slackurl + "files.upload?" + q.Encode(),
+			Data:        nil,
+			Contenttype: "application/x-www-form-urlencoded",
+			Accesstoken: d.token,
+			Dtime:       10,
+		})
+	}
+	for _, f := range p.Files {
+		q.Set("filename", f.Name)
+		r, err := slackMultipartReq(d.token, q, f.Name, bytes.NewReader(f.Data))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", f.Name, err))
+			continue
+		}
+		upload(f.Name, r)
+	}
+	res.ID = strings.Join(ids, ",")
+	if len(errs) > 0 {
+		res.OK = false
+		res.Error = strings.Join(errs, "; ")
+	}
+	res.Response = destResponses(responses)
+	return res
+}
+
+// Update : Files of Slack cannot be edited, so the files are uploaded as new files. The old files are not deleted.
+func (d *slackDest) Update(id string, p *destPayload) destResult {
+	res := d.Submit(p)
+	res.Action = "update"
+	return res
+}
+
+// Delete : Delete files. id is file IDs separated by ",".
+func (d *slackDest) Delete(id string) destResult {
+	return d.filesAPI("delete", "files.delete", id)
+}
+
+// Get : Retrieve information of files. id is file IDs separated by ",".
+func (d *slackDest) Get(id string) destResult {
+	return d.filesAPI("get", "files.info", id)
+}
+
+// filesAPI : Request to method of Slack for each file ID.
+func (d *slackDest) filesAPI(action, method, id string) destResult {
+	res := destResult{
+		Destination: d.name,
+		Type:        "slack",
+		Action:      action,
+		ID:          id,
+		OK:          true,
+	}
+	var errs []string
+	var responses []json.RawMessage
+	for _, fid := range strings.Split(id, ",") {
+		q := url.Values{}
+		q.Set("token", d.token)
+		q.Set("file", strings.TrimSpace(fid))
+		r := &utl.RequestParams{
+			Method:      "POST",
+			APIURL:      slackurl + method + "?" + q.Encode(),
+			Data:        nil,
+			Contenttype: "application/x-www-form-urlencoded",
+			Dtime:       10,
+		}
+		e, body := destFetch(d.name, "slack", action, r)
+		res.mergeStatus(e)
+		var se slackError
+		json.Unmarshal(body, &se)
+		switch {
+		case !e.OK:
+			errs = append(errs, fmt.Sprintf("%s: %s", fid, e.Error))
+		case !se.OK:
+			errs = append(errs, fmt.Sprintf("%s: %s", fid, se.Error))
+		}
+		if e.Response != nil {
+			responses = append(responses, e.Response)
+		}
+	}
+	if len(errs) > 0 {
+		res.OK = false
+		res.Error = strings.Join(errs, "; ")
+	}
+	res.Response = destResponses(responses)
+	return res
 }
@@ -0,0 +1,233 @@
+// Package main (materials_slack_delete.go) :
+// Materials for deleting channel histories of Slack with throttling and checkpoints.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tanaikech/gislack/utl"
+)
+
+const (
+	// slackTier3Interval : chat.delete is Tier 3 (50+ requests per minute).
+	slackTier3Interval = 1200 * time.Millisecond
+	// slackMaxRetry : Maximum number of retries for "429 Too Many Requests".
+	slackMaxRetry = 5
+)
+
+// deleteCheckpoint : Progress of deleting channel histories. This is saved to the directory of gislack.cfg.
+type deleteCheckpoint struct {
+	Channel   string            `json:"channel"`
+	Filter    string            `json:"filter"`
+	Targets   []string          `json:"targets"`
+	Next      int               `json:"next"`
+	Deleted   int               `json:"deleted"`
+	Failed    map[string]string `json:"failed,omitempty"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// slackRequestWithRetry : Request to Slack. When Slack returns 429, the request is retried after Retry-After.
+// The body of r is not re-sent, so this is used for requests without body.
+func slackRequestWithRetry(r *utl.RequestParams) ([]byte, error) {
+	for i := 0; ; i++ {
+		res, err := r.FetchAPIres()
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != 429 {
+			if res.StatusCode-300 >= 0 {
+				return body, fmt.Errorf("Status Code: %d", res.StatusCode)
+			}
+			return body, nil
+		}
+		if i >= slackMaxRetry {
+			return body, fmt.Errorf("rate limited by Slack %d times", i+1)
+		}
+		wait, err := strconv.Atoi(res.Header.Get("Retry-After"))
+		if err != nil || wait <= 0 {
+			wait = 1 << uint(i)
+		}
+		if err := sleepContext(r.Context, time.Duration(wait)*time.Second); err != nil {
+			return body, err
+		}
+	}
+}
+
+// sleepContext : Sleep for d. When ctx is canceled, it returns immediately with the error of ctx.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// slackDeleteChannelAllHistory : Delete histories matched to the filters in order of the old date. When "deleteallhistories" is used, all of them are deleted.
+// Requests are throttled for the rate limit, and the progress is saved as a checkpoint for each channel and filter.
+// When an interrupted run is executed again with the same options, it resumes from the checkpoint.
+// When SIGINT is received, the request in progress and the wait for the rate limit are canceled. The canceled history is not counted, and it is retried on the next run.
+func (s *slackContainer) slackDeleteChannelAllHistory() {
+	numdel := s.jsonControl.Options["deletehistories"].(int)
+	all := s.jsonControl.Options["deleteallhistories"].(bool)
+	dryrun := s.jsonControl.Options["dryrun"].(bool)
+	channel := s.slackGetChannels().slackChannelNameToID()
+	filter := url.Values{}
+	for _, key := range []string{"since", "until", "user", "contains"} {
+		filter.Set(key, s.jsonControl.Options[key].(string))
+	}
+	if all {
+		filter.Set("number", "all")
+	} else {
+		filter.Set("number", strconv.Itoa(numdel))
+	}
+	cpfile := deleteCheckpointFile(s.cfgdir, channel, filter.Encode())
+	cp := &deleteCheckpoint{}
+	if data, err := ioutil.ReadFile(cpfile); err == nil && json.Unmarshal(data, cp) == nil &&
+		cp.Channel == channel && cp.Filter == filter.Encode() && !dryrun {
+		fmt.Printf("# Resume from the checkpoint (%d/%d) saved at %s.\n", cp.Next, len(cp.Targets), cp.UpdatedAt.In(time.Local).Format("20060102_15:04:05"))
+	} else {
+		ar := s.slackGetChannelHistory().ChannelHistory.Messages
+		cp = &deleteCheckpoint{
+			Channel: channel,
+			Filter:  filter.Encode(),
+			Failed:  map[string]string{},
+		}
+		for i := len(ar) - 1; i >= 0 && (all || len(cp.Targets) < numdel); i-- {
+			cp.Targets = append(cp.Targets, ar[i].Ts)
+		}
+		if dryrun {
+			s.slackDispDeleteTargets(cp.Targets)
+			return
+		}
+	}
+	if len(cp.Targets) == 0 {
+		fmt.Printf("No history in channel %s.\n", s.jsonControl.Options["channel"].(string))
+		return
+	}
+	if cp.Failed == nil {
+		cp.Failed = map[string]string{}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	bar := newProgressBar(len(cp.Targets))
+	for i := 0; i < cp.Next; i++ {
+		bar.Increment()
+	}
+	for cp.Next < len(cp.Targets) && ctx.Err() == nil {
+		start := time.Now()
+		ts := cp.Targets[cp.Next]
+		p := url.Values{}
+		p.Set("token", s.slackParams.Token)
+		p.Set("ts", ts)
+		p.Set("channel", channel)
+		r := &utl.RequestParams{
+			Method:      "POST",
+			APIURL:      slackurl + "chat.delete?" + p.Encode(),
+			Data:        nil,
+			Contenttype: "application/x-www-form-urlencoded",
+			Dtime:       10,
+			Context:     ctx,
+		}
+		body, err := slackRequestWithRetry(r)
+		if ctx.Err() != nil {
+			break
+		}
+		var se slackError
+		json.Unmarshal(body, &se)
+		switch {
+		case err != nil:
+			cp.Failed[ts] = err.Error()
+		case !se.OK && se.Error != "message_not_found":
+			cp.Failed[ts] = se.Error
+		default:
+			cp.Deleted++
+		}
+		bar.Increment()
+		cp.Next++
+		cp.UpdatedAt = time.Now()
+		if err := cp.save(cpfile); err != nil {
+			fmt.Fprintf(os.Stderr, "\nWarning: Checkpoint couldn't be saved. [ %v ]\n", err)
+		}
+		if wait := slackTier3Interval - time.Since(start); wait > 0 && cp.Next < len(cp.Targets) {
+			sleepContext(ctx, wait)
+		}
+	}
+	if ctx.Err() != nil {
+		bar.Finish()
+		fmt.Fprintf(os.Stderr, "Interrupted. %d of %d histories were deleted. Please run the same command again to resume from the checkpoint.\n", cp.Deleted, len(cp.Targets))
+		os.Exit(130)
+	}
+	bar.FinishPrint(fmt.Sprintf("Done. %d histories were deleted.", cp.Deleted))
+	for ts, e := range cp.Failed {
+		fmt.Fprintf(os.Stderr, "Error: [ %s ] History %s couldn't be deleted. Owner of this message may not be you.\n", e, ts)
+	}
+	os.Remove(cpfile)
+	return
+}
+
+// deleteCheckpointFile : Path of the checkpoint for the channel and the filter. Runs with other filters use other checkpoints, so they don't overwrite each other.
+func deleteCheckpointFile(dir, channel, filter string) string {
+	sum := sha256.Sum256([]byte(filter))
+	return filepath.Join(dir, fmt.Sprintf("%s_delete_%s_%s.json", appname, channel, hex.EncodeToString(sum[:6])))
+}
+
+// save : Save the checkpoint.
+func (cp *deleteCheckpoint) save(file string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// slackDispDeleteTargets : Display histories which will be deleted. This is for the dry run.
+func (s *slackContainer) slackDispDeleteTargets(targets []string) {
+	texts := map[string]channelMessage{}
+	for _, e := range s.ChannelHistory.Messages {
+		texts[e.Ts] = e
+	}
+	buffer := &bytes.Buffer{}
+	w := new(tabwriter.Writer)
+	w.Init(buffer, 0, 4, 1, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "# Created date", "# text", "# user", "# ts(historyID)")
+	for _, ts := range targets {
+		m := texts[ts]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			slackTsToTime(ts).Format("20060102_15:04:05"),
+			m.Text,
+			m.User,
+			ts,
+		)
+	}
+	w.Flush()
+	fmt.Printf("%s", buffer)
+	fmt.Printf("\n# Dry run: %d histories will be deleted.\n", len(targets))
+}
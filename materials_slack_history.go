@@ -0,0 +1,317 @@
+// Package main (materials_slack_history.go) :
+// Materials for filtering and exporting channel histories of Slack.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tanaikech/gislack/utl"
+)
+
+// historyFilter : Filter for channel histories
+type historyFilter struct {
+	Oldest   string
+	Latest   string
+	User     string
+	Contains *regexp.Regexp
+}
+
+// slackUsersList : User list of Slack
+type slackUsersList struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Members []struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		RealName string `json:"real_name"`
+		Profile  struct {
+			DisplayName string `json:"display_name"`
+		} `json:"profile"`
+	} `json:"members"`
+	ResponseMetadata struct {
+		NextCursor string `json:"next_cursor"`
+	} `json:"response_metadata"`
+}
+
+// slackHistoryFilter : Create a filter for channel histories from options.
+func (s *slackContainer) slackHistoryFilter() (*historyFilter, error) {
+	f := &historyFilter{
+		User: s.jsonControl.Options["user"].(string),
+	}
+	var err error
+	if v := s.jsonControl.Options["since"].(string); len(v) > 0 {
+		if f.Oldest, err = slackParseTime(v, false); err != nil {
+			return nil, err
+		}
+	}
+	if v := s.jsonControl.Options["until"].(string); len(v) > 0 {
+		if f.Latest, err = slackParseTime(v, true); err != nil {
+			return nil, err
+		}
+	}
+	if v := s.jsonControl.Options["contains"].(string); len(v) > 0 {
+		if f.Contains, err = regexp.Compile(v); err != nil {
+			return nil, fmt.Errorf("'%s' is not a valid regex: %v", v, err)
+		}
+	}
+	return f, nil
+}
+
+// match : Check whether a message matches to the filter. Oldest and latest are filtered by Slack.
+func (f *historyFilter) match(m channelMessage) bool {
+	if len(f.User) > 0 && m.User != f.User && m.Username != f.User {
+		return false
+	}
+	if f.Contains != nil && !f.Contains.MatchString(m.Text) {
+		return false
+	}
+	return true
+}
+
+// slackParseTime : Convert a date to a Slack timestamp.
+// Unix time, RFC3339, "2006-01-02" and "20060102_15:04:05" can be used.
+// When endOfDay is true, a date without time means the end of the day.
+func slackParseTime(v string, endOfDay bool) (string, error) {
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return v, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return strconv.FormatInt(t.Unix(), 10), nil
+	}
+	if t, err := time.ParseInLocation("20060102_15:04:05", v, time.Local); err == nil {
+		return strconv.FormatInt(t.Unix(), 10), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return strconv.FormatInt(t.Unix(), 10), nil
+	}
+	return "", fmt.Errorf("'%s' is not a valid date. Please use unix time, RFC3339, '2006-01-02' or '20060102_15:04:05'", v)
+}
+
+// slackTsToTime : Convert a Slack timestamp to time.
+func slackTsToTime(ts string) time.Time {
+	ut, _ := strconv.ParseFloat(ts, 64)
+	return time.Unix(int64(ut), 0)
+}
+
+// slackGetReplies : Retrieve replies of a thread. The parent message is not included.
+func (s *slackContainer) slackGetReplies(channel, ts string) ([]channelMessage, error) {
+	var replies []channelMessage
+	var cursor string
+	for {
+		p := url.Values{}
+		p.Set("token", s.slackParams.Token)
+		p.Set("channel", channel)
+		p.Set("ts", ts)
+		p.Set("limit", strconv.Itoa(200))
+		p.Set("cursor", cursor)
+		r := &utl.RequestParams{
+			Method:      "POST",
+			APIURL:      slackurl + "conversations.replies?" + p.Encode(),
+			Data:        nil,
+			Contenttype: "application/x-www-form-urlencoded",
+			Dtime:       10,
+		}
+		body, err := r.FetchAPI()
+		if err != nil {
+			return nil, err
+		}
+		var ch channelHistory
+		json.Unmarshal(body, &ch)
+		if !ch.OK {
+			return nil, fmt.Errorf("%s", ch.Error)
+		}
+		for _, e := range ch.Messages {
+			if e.Ts != ts {
+				replies = append(replies, e)
+			}
+		}
+		cursor = ch.ResponseMetadata.NextCursor
+		if !ch.HasMore || len(cursor) == 0 {
+			break
+		}
+	}
+	return replies, nil
+}
+
+// slackGetUserNames : Retrieve user names as a map of user ID to name.
+func (s *slackContainer) slackGetUserNames() (map[string]string, error) {
+	names := map[string]string{}
+	var cursor string
+	for {
+		p := url.Values{}
+		p.Set("token", s.slackParams.Token)
+		p.Set("limit", strconv.Itoa(200))
+		p.Set("cursor", cursor)
+		r := &utl.RequestParams{
+			Method:      "POST",
+			APIURL:      slackurl + "users.list?" + p.Encode(),
+			Data:        nil,
+			Contenttype: "application/x-www-form-urlencoded",
+			Dtime:       10,
+		}
+		body, err := r.FetchAPI()
+		if err != nil {
+			return nil, err
+		}
+		var ul slackUsersList
+		json.Unmarshal(body, &ul)
+		if !ul.OK {
+			return nil, fmt.Errorf("%s", ul.Error)
+		}
+		for _, e := range ul.Members {
+			switch {
+			case len(e.Profile.DisplayName) > 0:
+				names[e.ID] = e.Profile.DisplayName
+			case len(e.RealName) > 0:
+				names[e.ID] = e.RealName
+			default:
+				names[e.ID] = e.Name
+			}
+		}
+		cursor = ul.ResponseMetadata.NextCursor
+		if len(cursor) == 0 {
+			break
+		}
+	}
+	return names, nil
+}
+
+// slackExportChannelHistory : Export channel histories as jsonl, csv or markdown. Thread replies are included.
+func (s *slackContainer) slackExportChannelHistory(format string) {
+	if format != "jsonl" && format != "csv" && format != "markdown" {
+		fmt.Fprintf(os.Stderr, "Error: '%s' is not a supported format. Please use 'table', 'jsonl', 'csv' or 'markdown'.\n", format)
+		os.Exit(1)
+	}
+	channel := s.slackChannelNameToID()
+	names, err := s.slackGetUserNames()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: User names couldn't be retrieved. User IDs are used. [ %v ]\n", err)
+		names = map[string]string{}
+	}
+	userName := func(m *channelMessage) {
+		if name, ok := names[m.User]; ok {
+			m.UserName = name
+		} else if len(m.Username) > 0 {
+			m.UserName = m.Username
+		} else {
+			m.UserName = m.User
+		}
+	}
+	ar := s.ChannelHistory.Messages
+	msgs := make([]channelMessage, 0, len(ar))
+	for i := len(ar) - 1; i >= 0; i-- {
+		m := ar[i]
+		userName(&m)
+		if m.ReplyCount > 0 && m.ThreadTs == m.Ts {
+			replies, err := s.slackGetReplies(channel, m.Ts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Replies of %s couldn't be retrieved. [ %v ]\n", m.Ts, err)
+			}
+			for j := range replies {
+				userName(&replies[j])
+			}
+			m.Replies = replies
+		}
+		msgs = append(msgs, m)
+	}
+	var w io.Writer = os.Stdout
+	var fs *os.File
+	if out := s.jsonControl.Options["out"].(string); len(out) > 0 {
+		fs, err = os.Create(out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		w = fs
+	}
+	switch format {
+	case "jsonl":
+		err = writeHistoryJSONL(w, msgs)
+	case "csv":
+		err = writeHistoryCSV(w, msgs)
+	case "markdown":
+		err = writeHistoryMarkdown(w, s.jsonControl.Options["channel"].(string), msgs)
+	}
+	if fs != nil {
+		if cerr := fs.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// writeHistoryJSONL : Write messages as JSON Lines. Thread replies are included in each message.
+func writeHistoryJSONL(w io.Writer, msgs []channelMessage) error {
+	enc := json.NewEncoder(w)
+	for _, m := range msgs {
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHistoryCSV : Write messages as CSV. Thread replies follow their parent message.
+func writeHistoryCSV(w io.Writer, msgs []channelMessage) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"ts", "datetime", "user", "user_name", "thread_ts", "text"})
+	row := func(m channelMessage) []string {
+		return []string{
+			m.Ts,
+			slackTsToTime(m.Ts).Format("20060102_15:04:05"),
+			m.User,
+			m.UserName,
+			m.ThreadTs,
+			m.Text,
+		}
+	}
+	for _, m := range msgs {
+		cw.Write(row(m))
+		for _, r := range m.Replies {
+			cw.Write(row(r))
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeHistoryMarkdown : Write messages as a Markdown transcript. Thread replies are inlined as quotes.
+func writeHistoryMarkdown(w io.Writer, channel string, msgs []channelMessage) error {
+	if _, err := fmt.Fprintf(w, "# #%s\n\n", strings.TrimPrefix(channel, "#")); err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if _, err := fmt.Fprintf(w, "**%s** (%s):\n\n%s\n\n",
+			m.UserName,
+			slackTsToTime(m.Ts).Format("2006-01-02 15:04:05"),
+			m.Text,
+		); err != nil {
+			return err
+		}
+		for _, r := range m.Replies {
+			if _, err := fmt.Fprintf(w, "> **%s** (%s):\n>\n> %s\n\n",
+				r.UserName,
+				slackTsToTime(r.Ts).Format("2006-01-02 15:04:05"),
+				strings.Replace(r.Text, "\n", "\n> ", -1),
+			); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
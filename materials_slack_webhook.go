@@ -0,0 +1,295 @@
+// Package main (materials_slack_webhook.go) :
+// Materials for incoming webhooks of Slack. In this mode, the access token of Slack is not required.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tanaikech/gislack/utl"
+)
+
+// webhookMaxSectionText : Maximum length of text in a section block of Block Kit.
+const webhookMaxSectionText = 3000
+
+// webhookPayload : Payload for incoming webhooks of Slack
+type webhookPayload struct {
+	Text   string        `json:"text"`
+	Blocks []interface{} `json:"blocks,omitempty"`
+}
+
+// webhookResult : Result of posting to an incoming webhook
+type webhookResult struct {
+	Webhook  string    `json:"webhook"`
+	OK       bool      `json:"ok"`
+	Error    string    `json:"error,omitempty"`
+	PostedAt time.Time `json:"posted_at,omitempty"`
+}
+
+// webhookSimpleResult : Simple result of double submissions with the incoming webhook. The gist ID deleted by the rollback is empty, and the rollback is included.
+type webhookSimpleResult struct {
+	GistCreatedAt string           `json:"gist_created_at"`
+	GistID        string           `json:"gist_id"`
+	Webhook       string           `json:"slack_webhook"`
+	OK            bool             `json:"ok"`
+	Rollback      []doubleRollback `json:"rollback,omitempty"`
+}
+
+// webhookTokenOnlyKeys : Options which cannot be used in webhook mode because of files, channels or access token.
+var webhookTokenOnlyKeys = []string{
+	"channel",
+	"filetype",
+	"channellist",
+	"filelist",
+	"filelistasjson",
+	"getfile",
+	"all",
+	"channelhistory",
+	"deletefile",
+	"deletefiles",
+	"deletehistory",
+	"deletehistories",
+	"deleteallhistories",
+}
+
+// useWebhook : Check whether an incoming webhook is used.
+func (i *iniparamsContainer) useWebhook() bool {
+	u, _ := i.jsonControl.Options["webhook-url"].(string)
+	n, _ := i.jsonControl.Options["webhook"].(string)
+	return len(u) > 0 || len(n) > 0
+}
+
+// slackWebhookInit : Decide the URL of incoming webhook from "webhook-url" or "webhook" of gislack.cfg.
+func (s *slackContainer) slackWebhookInit(webhooks map[string]string) {
+	if u, _ := s.jsonControl.Options["webhook-url"].(string); len(u) > 0 {
+		s.slackParams.WebhookName = "webhook-url"
+		s.slackParams.WebhookURL = u
+		return
+	}
+	if n, _ := s.jsonControl.Options["webhook"].(string); len(n) > 0 {
+		u, ok := webhooks[n]
+		if !ok || len(u) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: Webhook '%s' is not found in 'slack.webhooks' of %s.\n", n, cfgFile)
+			os.Exit(1)
+		}
+		s.slackParams.WebhookName = n
+		s.slackParams.WebhookURL = u
+	}
+}
+
+// slackWebhookMode : Check whether this container uses an incoming webhook.
+func (s *slackContainer) slackWebhookMode() bool {
+	return len(s.slackParams.WebhookURL) > 0
+}
+
+// slackWebhookChk : Stop when the options which cannot be used in webhook mode are used.
+func (s *slackContainer) slackWebhookChk() *slackContainer {
+	var used []string
+	for _, key := range webhookTokenOnlyKeys {
+		switch v := s.jsonControl.Options[key].(type) {
+		case string:
+			if len(v) > 0 {
+				used = append(used, key)
+			}
+		case bool:
+			if v {
+				used = append(used, key)
+			}
+		case int:
+			if v != 0 {
+				used = append(used, key)
+			}
+		}
+	}
+	if len(used) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: '%s' cannot be used in webhook mode. The channel of an incoming webhook is fixed, and files cannot be handled without the access token. Please use these without '--webhook-url' and '--webhook'.\n", strings.Join(used, "', '"))
+		os.Exit(1)
+	}
+	return s
+}
+
+// slackWebhookPayload : Create a payload with title, comment, content and link. When "blocks" is used, Block Kit is used.
+func (s *slackContainer) slackWebhookPayload(title, comment, content, link string) *webhookPayload {
+	escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	var lines []string
+	if len(title) > 0 {
+		lines = append(lines, "*"+escape.Replace(title)+"*")
+	}
+	if len(comment) > 0 {
+		lines = append(lines, comment)
+	}
+	if len(link) > 0 {
+		lines = append(lines, "<"+link+">")
+	}
+	if len(content) > 0 {
+		lines = append(lines, "```"+escape.Replace(content)+"```")
+	}
+	p := &webhookPayload{
+		Text: strings.Join(lines, "\n"),
+	}
+	if b, _ := s.jsonControl.Options["blocks"].(bool); !b {
+		return p
+	}
+	section := func(text string) map[string]interface{} {
+		return map[string]interface{}{
+			"type": "section",
+			"text": map[string]interface{}{"type": "mrkdwn", "text": text},
+		}
+	}
+	if len(title) > 0 {
+		p.Blocks = append(p.Blocks, map[string]interface{}{
+			"type": "header",
+			"text": map[string]interface{}{"type": "plain_text", "text": title},
+		})
+	}
+	if len(comment) > 0 {
+		p.Blocks = append(p.Blocks, section(comment))
+	}
+	if len(link) > 0 {
+		p.Blocks = append(p.Blocks, section("<"+link+"|"+link+">"))
+	}
+	if len(content) > 0 {
+		p.Blocks = append(p.Blocks, section("```"+webhookTruncate(escape, content, webhookMaxSectionText-20)+"```"))
+	}
+	return p
+}
+
+// webhookTruncate : Escape content and truncate it within max bytes. The content is cut on a rune boundary before escaping, so neither a multibyte rune nor an escaped entity is split.
+func webhookTruncate(escape *strings.Replacer, content string, max int) string {
+	if c := escape.Replace(content); len(c) <= max {
+		return c
+	}
+	var b strings.Builder
+	for _, r := range content {
+		e := escape.Replace(string(r))
+		if b.Len()+len(e) > max {
+			break
+		}
+		b.WriteString(e)
+	}
+	return b.String() + "\n..."
+}
+
+// slackWebhookPost : Post a payload to the incoming webhook.
+func (s *slackContainer) slackWebhookPost(p *webhookPayload) webhookResult {
+	res := webhookResult{
+		Webhook: s.slackParams.WebhookName,
+	}
+	payload, _ := json.Marshal(p)
+	r := &utl.RequestParams{
+		Method:      "POST",
+		APIURL:      s.slackParams.WebhookURL,
+		Data:        bytes.NewBuffer(payload),
+		Contenttype: "application/json",
+		Dtime:       10,
+	}
+	body, err := r.FetchAPI()
+	if err != nil {
+		res.Error = fmt.Sprintf("%s, %s", err, strings.TrimSpace(string(body)))
+		return res
+	}
+	res.OK = true
+	res.PostedAt = time.Now()
+	return res
+}
+
+// slackWebhookSubmit : Post a file or content to the incoming webhook.
+func (s *slackContainer) slackWebhookSubmit() {
+	content := s.jsonControl.Options["content"].(string)
+	if f := s.jsonControl.Options["file"].(string); len(f) > 0 {
+		if filepath.Dir(f) == "." {
+			f = filepath.Join(s.workdir, f)
+		}
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		content = string(data)
+	}
+	res := s.slackWebhookPost(s.slackWebhookPayload(
+		s.jsonControl.Options["title"].(string),
+		s.jsonControl.Options["initialcomment"].(string),
+		content,
+		"",
+	))
+	if s.jsonControl.Options["simpleresult"].(bool) {
+		result, _ := json.Marshal(struct {
+			Webhook string `json:"slack_webhook"`
+			OK      bool   `json:"ok"`
+		}{res.Webhook, res.OK})
+		fmt.Println(string(result))
+	} else {
+		var result []byte
+		if s.jsonControl.Options["jsonparser"].(bool) {
+			result, _ = json.MarshalIndent(res, "", "  ")
+		} else {
+			result, _ = json.Marshal(res)
+		}
+		fmt.Println(string(result))
+	}
+	if !res.OK {
+		os.Exit(1)
+	}
+}
+
+// doubleSubmitWebhook : Submit to Gist, and post the link of the gist to the incoming webhook.
+// When "atomic" is used and the webhook failed, the gist is deleted or reverted.
+func (p *iniparamsContainer) doubleSubmitWebhook(g *doubleRequest, s *slackContainer, snapshot *gistGetList) {
+	s.slackWebhookChk()
+	gr := doubleFetch(*g)
+	d := &doubleResults{}
+	json.Unmarshal([]byte(gr.Body), &d.Gist)
+	if len(gr.Error) > 0 || d.Gist.ID == "" {
+		fmt.Fprintf(os.Stderr, "Error: The file couldn't submit to Gist. Nothing was posted to the webhook. %s, %s\n", gr.Error, gr.Body)
+		os.Exit(1)
+	}
+	d.Gist.CreatedAt = d.Gist.CreatedAt.In(time.Local)
+	d.Gist.UpdatedAt = d.Gist.UpdatedAt.In(time.Local)
+	w := s.slackWebhookPost(s.slackWebhookPayload(
+		p.jsonControl.Options["title"].(string),
+		p.jsonControl.Options["initialcomment"].(string),
+		"",
+		d.Gist.HTMLURL,
+	))
+	d.Webhook = &w
+	if atomic, _ := p.jsonControl.Options["atomic"].(bool); atomic && !w.OK {
+		d.Rollback = append(d.Rollback, p.gistRollback(d.Gist, snapshot))
+	}
+	p.doubleRecord(d)
+	if p.jsonControl.Options["simpleresult"].(bool) {
+		r := webhookSimpleResult{
+			GistCreatedAt: d.Gist.CreatedAt.Format("20060102_15:04:05"),
+			GistID:        d.Gist.ID,
+			Webhook:       w.Webhook,
+			OK:            w.OK,
+			Rollback:      d.Rollback,
+		}
+		for _, e := range d.Rollback {
+			if e.OK && e.Action == "delete" && e.ID == r.GistID {
+				r.GistID, r.GistCreatedAt = "", "Rolled back."
+			}
+		}
+		result, _ := json.Marshal(r)
+		fmt.Println(string(result))
+	} else {
+		d.TotalEt = math.Trunc(time.Now().Sub(p.pstart).Seconds()*1000) / 1000
+		var result []byte
+		if p.jsonControl.Options["jsonparser"].(bool) {
+			result, _ = json.MarshalIndent(d, "", "  ")
+		} else {
+			result, _ = json.Marshal(d)
+		}
+		fmt.Println(string(result))
+	}
+	if !w.OK {
+		os.Exit(1)
+	}
+}
@@ -3,6 +3,7 @@
 package utl
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -10,27 +11,35 @@ import (
 	"net/http"
 	"os"
 	"strconv"
-	"time"
 )
 
 // RequestParams : Parameters for FetchAPI
+// Dtime is the timeout in seconds for waiting the response header, and it is used only when ResponseHeader of Timeouts is 0.
+// When Context is set, the request is canceled with it.
 type RequestParams struct {
-	Method       string
-	APIURL       string
-	Data         io.Reader
-	AcceptHeader string
-	Contenttype  string
-	Accesstoken  string
-	Dtime        int64
+	Method        string
+	APIURL        string
+	Data          io.Reader
+	AcceptHeader  string
+	Contenttype   string
+	Accesstoken   string
+	Authorization string
+	Dtime         int64
+	Context       context.Context
+}
+
+// newRequest : Create a request with the context.
+func (r *RequestParams) newRequest() (*http.Request, error) {
+	ctx := r.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return http.NewRequestWithContext(ctx, r.Method, r.APIURL, r.Data)
 }
 
 // FetchAPI : For fetching data to URL.
 func (r *RequestParams) FetchAPI() ([]byte, error) {
-	req, err := http.NewRequest(
-		r.Method,
-		r.APIURL,
-		r.Data,
-	)
+	req, err := r.newRequest()
 	if err != nil {
 		return nil, err
 	}
@@ -40,13 +49,16 @@ func (r *RequestParams) FetchAPI() ([]byte, error) {
 	if len(r.Contenttype) > 0 {
 		req.Header.Set("Content-Type", r.Contenttype)
 	}
-	if len(r.Accesstoken) > 0 {
+	if len(r.Authorization) > 0 {
+		req.Header.Set("Authorization", r.Authorization)
+	} else if len(r.Accesstoken) > 0 {
 		req.Header.Set("Authorization", "Bearer "+r.Accesstoken)
 	}
-	client := &http.Client{
-		Timeout: time.Duration(r.Dtime) * time.Second,
+	res, err := r.client().Do(req)
+	if err == nil {
+		// The connection is returned to the pool of the shared transport only when the body is closed.
+		defer res.Body.Close()
 	}
-	res, err := client.Do(req)
 	if err != nil || res.StatusCode-300 >= 0 {
 		var msg []byte
 		var er string
@@ -68,17 +80,12 @@ func (r *RequestParams) FetchAPI() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
 	return body, err
 }
 
 // FetchAPIres : For fetching data to URL.
 func (r *RequestParams) FetchAPIres() (*http.Response, error) {
-	req, err := http.NewRequest(
-		r.Method,
-		r.APIURL,
-		r.Data,
-	)
+	req, err := r.newRequest()
 	if err != nil {
 		return nil, err
 	}
@@ -88,11 +95,10 @@ func (r *RequestParams) FetchAPIres() (*http.Response, error) {
 	if len(r.Contenttype) > 0 {
 		req.Header.Set("Content-Type", r.Contenttype)
 	}
-	if len(r.Accesstoken) > 0 {
+	if len(r.Authorization) > 0 {
+		req.Header.Set("Authorization", r.Authorization)
+	} else if len(r.Accesstoken) > 0 {
 		req.Header.Set("Authorization", "Bearer "+r.Accesstoken)
 	}
-	client := &http.Client{
-		Timeout: time.Duration(r.Dtime) * time.Second,
-	}
-	return client.Do(req)
+	return r.client().Do(req)
 }